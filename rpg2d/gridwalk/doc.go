@@ -0,0 +1,6 @@
+// Package gridwalk implements a reference set of movement
+// rules for entities that walk from cell to cell using a
+// coord.PathAction. The rules are an UpdatePhaseHandler and
+// a NarrowPhaseHandler that can be used by a simulation
+// that doesn't need rules of its own.
+package gridwalk
@@ -0,0 +1,296 @@
+package gridwalk
+
+import (
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// A Walker is an entity that walks from cell to cell.
+// While it is walking its Cell is the cell it is walking
+// out of and its Bounds must include the cell it is
+// walking into, so that the broad phase will put it into
+// a collision group with the entities it may collide with.
+type Walker interface {
+	entity.Entity
+
+	// Returns the path the walker is walking and
+	// false if the walker is standing still.
+	Path() (coord.PathAction, bool)
+
+	// Returns the walker standing still at the cell.
+	StandAt(coord.Cell) Walker
+}
+
+// A Priority returns true if walker a should win
+// a race with walker b into the same cell.
+type Priority func(a, b Walker) bool
+
+// The default Priority. The walker with the lowest id wins.
+func LowestIdFirst(a, b Walker) bool { return a.Id() < b.Id() }
+
+// Rules are the movement rules for walkers.
+//
+// Every collision between 2 entities is classified by
+// coord.NewPathCollision, or coord.NewCellCollision if
+// only 1 of them is walking. An entity that isn't a
+// Walker is always standing still. The moves are
+// accepted or rejected by the collision's type.
+//
+//	CT_NONE                 both are accepted
+//	CT_HEAD_TO_HEAD         a race into the same cell
+//	CT_FROM_SIDE            a race into the same cell
+//	CT_SAME_ORIG_DEST       a race into the same cell
+//	CT_SAME_ORIG            both are accepted
+//	CT_SAME_ORIG_PERP       both are accepted
+//	CT_A_INTO_B             A is accepted if B is accepted
+//	CT_A_INTO_B_FROM_SIDE   A is accepted if B is accepted
+//	CT_SWAP                 both are accepted if AllowSwaps
+//	CT_CELL_DEST            the walker is rejected
+//	CT_CELL_ORIG            the walker is accepted
+//
+// The winner of a race is the walker whose path started
+// first, so a walker isn't stopped half way into a cell.
+// If they started at the same time the winner is decided
+// by the Priority and the loser is rejected.
+//
+// Walkers walking into each other, A into B into C, are
+// resolved in order with quad.SolveCollisionGroup, so C
+// is resolved before B and B before A. If the walkers are
+// walking in a circle, A into B into C into A, none of
+// them can move and they are all rejected.
+//
+// A rejected walker is stood still at the cell it was
+// walking out of. An accepted walker is stood still at
+// the cell it was walking into by the update phase on
+// the tick its path ends.
+type Rules struct {
+	// Decides the winner of a race into the same
+	// cell that started at the same time.
+	// LowestIdFirst is used if it is nil.
+	Priority Priority
+
+	// If true, 2 walkers can swap cells with each
+	// other. Otherwise both walkers are rejected.
+	AllowSwaps bool
+}
+
+var _ quad.UpdatePhaseHandler = Rules{}
+var _ quad.ConcurrentNarrowPhaseHandler = Rules{}
+
+// Completes the path of a walker that ends on this tick.
+func (r Rules) Update(e entity.Entity, now stime.Time) entity.Entity {
+	w, isWalker := e.(Walker)
+	if !isWalker {
+		return e
+	}
+
+	path, isWalking := w.Path()
+	if !isWalking || path.Span.End > now {
+		return e
+	}
+
+	return w.StandAt(path.Dest)
+}
+
+// Accepts or rejects the moves of the walkers in the collision group.
+func (r Rules) ResolveCollisions(cg *quad.CollisionGroup, now stime.Time) ([]entity.Entity, []entity.Entity) {
+	s := &solver{
+		Rules:    r,
+		moves:    make(map[quad.Collision]move, len(cg.Collisions)),
+		rejected: make(map[entity.Id]bool),
+	}
+
+	if s.Priority == nil {
+		s.Priority = LowestIdFirst
+	}
+
+	for _, c := range cg.Collisions {
+		s.moves[c] = newMove(c)
+	}
+
+	quad.SolveCollisionGroup(*cg, s)
+
+	// A walker that was rejected after a collision that
+	// depends on it was resolved must reject the walkers
+	// that were walking into it. This only happens when
+	// a walker is rejected by a race or a swap.
+	for rejected := true; rejected; {
+		rejected = false
+		for _, c := range cg.Collisions {
+			rejected = s.rejectDependents(s.moves[c]) || rejected
+		}
+	}
+
+	entities := make([]entity.Entity, 0, len(cg.Entities))
+	for _, e := range cg.Entities {
+		if s.rejected[e.Id()] {
+			path, _ := e.(Walker).Path()
+			e = e.(Walker).StandAt(path.Orig)
+		}
+
+		entities = append(entities, e)
+	}
+
+	return entities, nil
+}
+
+// The rules don't have any state that is modified
+// while resolving a collision group.
+func (Rules) ConcurrencySafe() bool { return true }
+
+// A collision between 2 entities that may be walking.
+type move struct {
+	coord.CollisionType
+
+	// Walker is nil if the entity isn't walking
+	a, b   Walker
+	aPath  coord.PathAction
+	bPath  coord.PathAction
+	mover  entity.Entity
+	target entity.Entity
+}
+
+func walkerOf(e entity.Entity) (Walker, coord.PathAction) {
+	if w, isWalker := e.(Walker); isWalker {
+		if path, isWalking := w.Path(); isWalking {
+			return w, path
+		}
+	}
+
+	return nil, coord.PathAction{}
+}
+
+func newMove(c quad.Collision) (m move) {
+	m.a, m.aPath = walkerOf(c.A)
+	m.b, m.bPath = walkerOf(c.B)
+
+	switch {
+	case m.a != nil && m.b != nil:
+		pc := coord.NewPathCollision(m.aPath, m.bPath)
+		m.CollisionType = pc.Type()
+
+		switch m.CollisionType {
+		case coord.CT_A_INTO_B, coord.CT_A_INTO_B_FROM_SIDE:
+			// The path collision's A is the walker
+			// that is walking into the other walker.
+			if pc.A == m.aPath {
+				m.mover, m.target = c.A, c.B
+			} else {
+				m.mover, m.target = c.B, c.A
+			}
+
+		case coord.CT_SWAP:
+			m.mover, m.target = c.A, c.B
+		}
+
+	case m.a != nil:
+		m.CollisionType = coord.NewCellCollision(m.aPath, c.B.Cell()).Type()
+
+	case m.b != nil:
+		// Swap so A is the walker
+		m.a, m.aPath, m.b, m.bPath = m.b, m.bPath, nil, coord.PathAction{}
+		m.CollisionType = coord.NewCellCollision(m.aPath, c.A.Cell()).Type()
+
+	default:
+		m.CollisionType = coord.CT_NONE
+	}
+
+	return m
+}
+
+// Implements quad.CollisionSolver
+type solver struct {
+	Rules
+
+	moves    map[quad.Collision]move
+	rejected map[entity.Id]bool
+}
+
+func (s *solver) MovingEntity(c quad.Collision) (entity.Entity, bool) {
+	m := s.moves[c]
+	return m.mover, m.mover != nil
+}
+
+func (s *solver) ResolveCollision(c quad.Collision, inCycle bool) {
+	m := s.moves[c]
+
+	switch m.CollisionType {
+	case coord.CT_HEAD_TO_HEAD, coord.CT_FROM_SIDE, coord.CT_SAME_ORIG_DEST:
+		s.reject(s.loserOf(m))
+
+	case coord.CT_A_INTO_B, coord.CT_A_INTO_B_FROM_SIDE:
+		if inCycle {
+			s.reject(m.mover)
+			break
+		}
+
+		s.rejectDependents(m)
+
+	case coord.CT_SWAP:
+		if inCycle || !s.AllowSwaps {
+			s.reject(m.a)
+			s.reject(m.b)
+			break
+		}
+
+		s.rejectDependents(m)
+
+	case coord.CT_CELL_DEST:
+		s.reject(m.a)
+
+	case coord.CT_NONE, coord.CT_SAME_ORIG, coord.CT_SAME_ORIG_PERP, coord.CT_CELL_ORIG:
+	}
+}
+
+func (s *solver) reject(e entity.Entity) {
+	s.rejected[e.Id()] = true
+}
+
+// Rejects a walker that is walking into a rejected
+// entity. The walkers of a swap are both rejected if
+// either of them has been rejected. Returns true if
+// a walker has been rejected.
+func (s *solver) rejectDependents(m move) bool {
+	if m.target == nil {
+		return false
+	}
+
+	moverRejected, targetRejected := s.rejected[m.mover.Id()], s.rejected[m.target.Id()]
+
+	switch {
+	case moverRejected == targetRejected:
+		return false
+
+	case targetRejected:
+		s.reject(m.mover)
+		return true
+
+	case m.CollisionType == coord.CT_SWAP:
+		s.reject(m.target)
+		return true
+	}
+
+	return false
+}
+
+// Returns the walker that loses a race into the same cell.
+func (s *solver) loserOf(m move) Walker {
+	switch {
+	case s.rejected[m.a.Id()]:
+		return m.a
+	case s.rejected[m.b.Id()]:
+		return m.b
+
+	case m.aPath.Span.Start < m.bPath.Span.Start:
+		return m.b
+	case m.bPath.Span.Start < m.aPath.Span.Start:
+		return m.a
+
+	case s.Priority(m.a, m.b):
+		return m.b
+	default:
+		return m.a
+	}
+}
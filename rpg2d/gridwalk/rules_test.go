@@ -0,0 +1,301 @@
+package gridwalk_test
+
+import (
+	"fmt"
+
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/gridwalk"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+type mockWalker struct {
+	id   entity.Id
+	cell coord.Cell
+
+	path    coord.PathAction
+	walking bool
+}
+
+func (w mockWalker) String() string   { return fmt.Sprintf("mockWalker%v", w.id) }
+func (w mockWalker) Id() entity.Id    { return w.id }
+func (w mockWalker) Cell() coord.Cell { return w.cell }
+func (w mockWalker) Bounds() coord.Bounds {
+	if w.walking {
+		return w.path.Bounds()
+	}
+	return coord.Bounds{w.cell, w.cell}
+}
+func (w mockWalker) Flags() entity.Flag { return 0 }
+func (w mockWalker) ToState() entity.State {
+	return entitytest.MockEntityState{
+		Id:   w.id,
+		Name: w.String(),
+		Cell: w.cell,
+	}
+}
+
+func (w mockWalker) Path() (coord.PathAction, bool) { return w.path, w.walking }
+
+func (w mockWalker) StandAt(cell coord.Cell) gridwalk.Walker {
+	return mockWalker{id: w.id, cell: cell}
+}
+
+func standing(id entity.Id, cell coord.Cell) mockWalker {
+	return mockWalker{id: id, cell: cell}
+}
+
+func walking(id entity.Id, orig, dest coord.Cell, start, end stime.Time) mockWalker {
+	return mockWalker{
+		id:   id,
+		cell: orig,
+		path: coord.PathAction{
+			Span: stime.NewSpan(start, end),
+			Orig: orig,
+			Dest: dest,
+		},
+		walking: true,
+	}
+}
+
+func DescribeRules(c gospec.Context) {
+	cell := func(x, y int) coord.Cell { return coord.Cell{x, y} }
+
+	rules := gridwalk.Rules{}
+
+	newcg := func(collisions ...quad.Collision) *quad.CollisionGroup {
+		var cg quad.CollisionGroup
+		for _, c := range collisions {
+			cg = cg.AddCollision(c)
+		}
+		return &cg
+	}
+
+	// Returns the ids of the entities
+	// that are walking after resolving
+	// the collisions of the group.
+	resolve := func(cg *quad.CollisionGroup) []entity.Id {
+		entities, removed := rules.ResolveCollisions(cg, 1)
+		c.Assume(len(entities), Equals, len(cg.Entities))
+		c.Assume(len(removed), Equals, 0)
+
+		ids := make([]entity.Id, 0, len(entities))
+		for _, e := range entities {
+			if _, isWalking := e.(gridwalk.Walker).Path(); isWalking {
+				ids = append(ids, e.Id())
+			}
+		}
+		return ids
+	}
+
+	pathType := func(a, b mockWalker) coord.CollisionType {
+		return coord.NewPathCollision(a.path, b.path).Type()
+	}
+
+	cellType := func(a, b mockWalker) coord.CollisionType {
+		return coord.NewCellCollision(a.path, b.cell).Type()
+	}
+
+	c.Specify("the rules", func() {
+		c.Specify("will complete a path on the tick it ends", func() {
+			w := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+
+			c.Expect(rules.Update(w, 9), Equals, w)
+			c.Expect(rules.Update(w, 10), Equals, standing(1, cell(1, 0)))
+		})
+
+		c.Specify("will not change an entity that isn't walking", func() {
+			e := entitytest.MockEntity{EntityId: 1}
+			c.Expect(rules.Update(e, 10), Equals, e)
+
+			w := standing(1, cell(0, 0))
+			c.Expect(rules.Update(w, 10), Equals, w)
+		})
+
+		c.Specify("will stand a rejected walker still where it started", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := standing(2, cell(1, 0))
+
+			entities, _ := rules.ResolveCollisions(newcg(quad.Collision{a, b}), 1)
+			c.Expect(entities, ContainsExactly, []entity.Entity{
+				standing(1, cell(0, 0)),
+				b,
+			})
+		})
+
+		c.Specify("will accept both walkers of a CT_NONE collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(0, 2), cell(1, 2), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_NONE)
+
+			c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1, 2})
+		})
+
+		c.Specify("will resolve a CT_HEAD_TO_HEAD collision as a race", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(2, 0), cell(1, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_HEAD_TO_HEAD)
+
+			c.Specify("won by the walker with priority", func() {
+				c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1})
+
+				rules.Priority = func(a, b gridwalk.Walker) bool { return a.Id() > b.Id() }
+				c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{2})
+			})
+
+			c.Specify("won by the walker that started first", func() {
+				a = walking(1, cell(0, 0), cell(1, 0), 5, 15)
+				c.Assume(pathType(a, b), Equals, coord.CT_HEAD_TO_HEAD)
+
+				c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{2})
+			})
+		})
+
+		c.Specify("will resolve a CT_FROM_SIDE collision as a race", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(1, 1), cell(1, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_FROM_SIDE)
+
+			c.Expect(resolve(newcg(quad.Collision{b, a})), ContainsExactly, []entity.Id{1})
+		})
+
+		c.Specify("will resolve a CT_SAME_ORIG_DEST collision as a race", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(0, 0), cell(1, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_SAME_ORIG_DEST)
+
+			c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1})
+		})
+
+		c.Specify("will accept both walkers of a CT_SAME_ORIG collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(0, 0), cell(-1, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_SAME_ORIG)
+
+			c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1, 2})
+		})
+
+		c.Specify("will accept both walkers of a CT_SAME_ORIG_PERP collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(0, 0), cell(0, 1), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_SAME_ORIG_PERP)
+
+			c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1, 2})
+		})
+
+		c.Specify("will resolve a CT_A_INTO_B collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 5)
+			b := walking(2, cell(1, 0), cell(2, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_A_INTO_B)
+
+			c.Specify("by accepting A if B is accepted", func() {
+				c.Expect(resolve(newcg(quad.Collision{b, a})), ContainsExactly, []entity.Id{1, 2})
+			})
+
+			c.Specify("by rejecting A if B is rejected", func() {
+				wall := standing(3, cell(2, 0))
+
+				c.Expect(resolve(newcg(
+					quad.Collision{a, b},
+					quad.Collision{b, wall},
+				)), ContainsExactly, []entity.Id{})
+			})
+		})
+
+		c.Specify("will resolve a CT_A_INTO_B_FROM_SIDE collision", func() {
+			a := walking(1, cell(1, 1), cell(1, 0), 0, 10)
+			b := walking(2, cell(1, 0), cell(2, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_A_INTO_B_FROM_SIDE)
+
+			c.Specify("by accepting A if B is accepted", func() {
+				c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1, 2})
+			})
+
+			c.Specify("by rejecting A if B is rejected", func() {
+				wall := standing(3, cell(2, 0))
+
+				c.Expect(resolve(newcg(
+					quad.Collision{a, b},
+					quad.Collision{b, wall},
+				)), ContainsExactly, []entity.Id{})
+			})
+		})
+
+		c.Specify("will resolve a CT_SWAP collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(1, 0), cell(0, 0), 0, 10)
+			c.Assume(pathType(a, b), Equals, coord.CT_SWAP)
+
+			c.Specify("by rejecting both walkers", func() {
+				c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{})
+			})
+
+			c.Specify("by accepting both walkers if swaps are allowed", func() {
+				rules.AllowSwaps = true
+				c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1, 2})
+
+				c.Specify("unless one of them loses a race", func() {
+					// Started first so wins the race into b's cell
+					d := walking(3, cell(2, 0), cell(1, 0), -5, 5)
+					c.Assume(pathType(a, d), Equals, coord.CT_HEAD_TO_HEAD)
+
+					c.Expect(resolve(newcg(
+						quad.Collision{a, b},
+						quad.Collision{a, d},
+					)), ContainsExactly, []entity.Id{3})
+				})
+			})
+		})
+
+		c.Specify("will reject a walker of a CT_CELL_DEST collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := standing(2, cell(1, 0))
+			c.Assume(cellType(a, b), Equals, coord.CT_CELL_DEST)
+
+			c.Expect(resolve(newcg(quad.Collision{b, a})), ContainsExactly, []entity.Id{})
+		})
+
+		c.Specify("will accept a walker of a CT_CELL_ORIG collision", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := standing(2, cell(0, 0))
+			c.Assume(cellType(a, b), Equals, coord.CT_CELL_ORIG)
+
+			c.Expect(resolve(newcg(quad.Collision{a, b})), ContainsExactly, []entity.Id{1})
+		})
+
+		c.Specify("will treat an entity that isn't a walker as standing still", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := entitytest.MockEntity{EntityId: 2, EntityCell: cell(1, 0)}
+
+			entities, _ := rules.ResolveCollisions(newcg(quad.Collision{a, b}), 1)
+			c.Expect(entities, ContainsExactly, []entity.Entity{
+				standing(1, cell(0, 0)),
+				b,
+			})
+		})
+
+		c.Specify("will reject every walker of a cycle", func() {
+			a := walking(1, cell(0, 0), cell(1, 0), 0, 10)
+			b := walking(2, cell(1, 0), cell(1, -1), 0, 10)
+			d := walking(3, cell(1, -1), cell(0, -1), 0, 10)
+			e := walking(4, cell(0, -1), cell(0, 0), 0, 10)
+
+			c.Assume(pathType(a, b), Equals, coord.CT_A_INTO_B_FROM_SIDE)
+			c.Assume(pathType(b, d), Equals, coord.CT_A_INTO_B_FROM_SIDE)
+			c.Assume(pathType(d, e), Equals, coord.CT_A_INTO_B_FROM_SIDE)
+			c.Assume(pathType(e, a), Equals, coord.CT_A_INTO_B_FROM_SIDE)
+
+			c.Expect(resolve(newcg(
+				quad.Collision{a, b},
+				quad.Collision{b, d},
+				quad.Collision{d, e},
+				quad.Collision{e, a},
+			)), ContainsExactly, []entity.Id{})
+		})
+	})
+}
@@ -0,0 +1,15 @@
+package gridwalk_test
+
+import (
+	"testing"
+
+	"github.com/ghthor/gospec"
+)
+
+func TestUnitSpecs(t *testing.T) {
+	r := gospec.NewRunner()
+
+	r.AddSpec(DescribeRules)
+
+	gospec.MainGoTest(r, t)
+}
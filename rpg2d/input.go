@@ -0,0 +1,136 @@
+package rpg2d
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// An InputCommand is a command that has been
+// pushed into an InputQueue by an actor's connection.
+type InputCommand struct {
+	Actor ActorId
+
+	// The time the command should be applied. Commands
+	// are applied on the first tick at or after IssuedAt.
+	IssuedAt stime.Time
+
+	// Assigned by the InputQueue in the order
+	// commands were pushed into the queue.
+	Seq uint64
+
+	Command interface{}
+}
+
+// An InputQueue buffers the commands sent by every actor's
+// connection until they are drained by the simulation.
+// It is safe to push commands from multiple go routines.
+type InputQueue struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending map[ActorId][]InputCommand
+}
+
+func NewInputQueue() *InputQueue {
+	return &InputQueue{
+		pending: make(map[ActorId][]InputCommand),
+	}
+}
+
+// Push a command that will be applied to the actor's
+// entity on the first tick at or after issuedAt.
+func (q *InputQueue) Push(actor ActorId, issuedAt stime.Time, cmd interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	q.pending[actor] = append(q.pending[actor], InputCommand{
+		Actor:    actor,
+		IssuedAt: issuedAt,
+		Seq:      q.seq,
+		Command:  cmd,
+	})
+}
+
+// Remove and return all of the actor's commands that were
+// issued at or before now. The commands are sorted by the
+// time they were issued and then by the order they were
+// pushed. Commands issued after now remain in the queue.
+func (q *InputQueue) Drain(actor ActorId, now stime.Time) []InputCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := q.pending[actor]
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var drained, remaining []InputCommand
+	for _, cmd := range pending {
+		if cmd.IssuedAt <= now {
+			drained = append(drained, cmd)
+		} else {
+			remaining = append(remaining, cmd)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(q.pending, actor)
+	} else {
+		q.pending[actor] = remaining
+	}
+
+	sort.Slice(drained, func(i, j int) bool {
+		if drained[i].IssuedAt != drained[j].IssuedAt {
+			return drained[i].IssuedAt < drained[j].IssuedAt
+		}
+		return drained[i].Seq < drained[j].Seq
+	})
+
+	return drained
+}
+
+// Discard all of the actor's commands.
+func (q *InputQueue) Forget(actor ActorId) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, actor)
+}
+
+// A CommandPhaseHandler is an input application phase that is
+// handed the commands that were drained from the InputQueue for
+// the actor the entity represents. Entities that don't represent
+// an actor, or actors without any commands, receive no commands.
+// It should return the same slice of entities an InputPhaseHandler would.
+type CommandPhaseHandler interface {
+	ApplyCommandsTo(entity.Entity, stime.Time, []InputCommand) []entity.Entity
+}
+
+// Convenience type so command phase handlers
+// can be written as closures or as functions.
+type CommandPhaseHandlerFn func(entity.Entity, stime.Time, []InputCommand) []entity.Entity
+
+func (f CommandPhaseHandlerFn) ApplyCommandsTo(e entity.Entity, now stime.Time, cmds []InputCommand) []entity.Entity {
+	return f(e, now, cmds)
+}
+
+var ErrMustProvideAnInputQueue = errors.New("user must provide an input queue to use a command phase handler")
+var ErrInputPhaseConflict = errors.New("user can only provide one of an input phase handler or a command phase handler")
+
+// Adapts a CommandPhaseHandler into a quad.InputPhaseHandler.
+// The map of entities to actors is only modified by the
+// simulation's go routine in between ticks.
+func commandInputPhase(q *InputQueue, h CommandPhaseHandler, entityActors map[entity.Id]ActorId) quad.InputPhaseHandler {
+	return quad.InputPhaseHandlerFn(func(e entity.Entity, now stime.Time) []entity.Entity {
+		var cmds []InputCommand
+		if actor, isActor := entityActors[e.Id()]; isActor {
+			cmds = q.Drain(actor, now)
+		}
+
+		return h.ApplyCommandsTo(e, now, cmds)
+	})
+}
@@ -0,0 +1,136 @@
+package rpg2d_test
+
+import (
+	"time"
+
+	"github.com/ghthor/filu/rpg2d"
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func commands(cmds []rpg2d.InputCommand) []interface{} {
+	result := make([]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		result = append(result, cmd.Command)
+	}
+	return result
+}
+
+func DescribeInputQueue(c gospec.Context) {
+	c.Specify("an input queue", func() {
+		q := rpg2d.NewInputQueue()
+
+		q.Push(1, 2, "b")
+		q.Push(1, 1, "a")
+		q.Push(2, 1, "x")
+		q.Push(1, 2, "c")
+		q.Push(1, 3, "d")
+
+		c.Specify("will drain commands in the order they were issued", func() {
+			c.Expect(commands(q.Drain(1, 2)), ContainsInOrder, []interface{}{"a", "b", "c"})
+		})
+
+		c.Specify("will keep commands issued in the future", func() {
+			c.Expect(commands(q.Drain(1, 0)), ContainsExactly, []interface{}{})
+			c.Expect(commands(q.Drain(1, 2)), ContainsExactly, []interface{}{"a", "b", "c"})
+			c.Expect(commands(q.Drain(1, 3)), ContainsExactly, []interface{}{"d"})
+			c.Expect(len(q.Drain(1, 3)), Equals, 0)
+		})
+
+		c.Specify("will keep the commands of each actor separate", func() {
+			c.Expect(commands(q.Drain(2, 3)), ContainsExactly, []interface{}{"x"})
+		})
+
+		c.Specify("can forget an actor's commands", func() {
+			q.Forget(1)
+			c.Expect(len(q.Drain(1, 3)), Equals, 0)
+			c.Expect(len(q.Drain(2, 3)), Equals, 1)
+		})
+	})
+
+	bounds := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	terrainMap, err := rpg2d.NewTerrainMap(bounds, string(rpg2d.TT_GRASS))
+	c.Assume(err, IsNil)
+
+	q, err := quad.New(bounds, 10, nil)
+	c.Assume(err, IsNil)
+
+	ticker := rpg2d.NewManualTicker(time.Time{})
+	inputs := rpg2d.NewInputQueue()
+
+	type applied struct {
+		entity entity.Id
+		now    stime.Time
+		cmd    interface{}
+	}
+
+	var appliedCmds []applied
+
+	def := rpg2d.SimulationDef{
+		FPS:        40,
+		TickSource: ticker,
+
+		QuadTree:   q,
+		TerrainMap: terrainMap,
+
+		UpdatePhaseHandler: mockUpdatePhase{},
+		CommandPhaseHandler: rpg2d.CommandPhaseHandlerFn(func(e entity.Entity, now stime.Time, cmds []rpg2d.InputCommand) []entity.Entity {
+			for _, cmd := range cmds {
+				appliedCmds = append(appliedCmds, applied{e.Id(), now, cmd.Command})
+			}
+			return []entity.Entity{e}
+		}),
+		InputQueue:         inputs,
+		NarrowPhaseHandler: mockNarrowPhase{},
+	}
+
+	c.Specify("a simulation with an input queue", func() {
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		defer func() {
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		}()
+
+		rs.ConnectActor(mockActor{
+			id:              1,
+			mockActorEntity: mockActorEntity{id: 5},
+		})
+
+		inputs.Push(1, 2, "move")
+		inputs.Push(1, 1, "face")
+
+		c.Assume(ticker.Step(2), Equals, 2)
+
+		c.Specify("will apply the commands to the actor's entity", func() {
+			c.Expect(appliedCmds, ContainsExactly, []applied{
+				{5, 1, "face"},
+				{5, 2, "move"},
+			})
+		})
+	})
+
+	c.Specify("a simulation will not begin", func() {
+		c.Specify("without an input queue", func() {
+			def.InputQueue = nil
+			_, err := def.Begin()
+			c.Expect(err, Equals, rpg2d.ErrMustProvideAnInputQueue)
+		})
+
+		c.Specify("with an input phase handler", func() {
+			def.InputPhaseHandler = mockInputPhase{}
+			_, err := def.Begin()
+			c.Expect(err, Equals, rpg2d.ErrInputPhaseConflict)
+		})
+	})
+}
@@ -0,0 +1,180 @@
+package rpg2d
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// TickMetrics are the measurements made while
+// calculating a tick of the simulation.
+type TickMetrics struct {
+	Now stime.Time
+
+	// Time taken to calculate the tick
+	// and write the state to all the actors.
+	Duration time.Duration
+
+	// Time taken to write the state to all the actors.
+	WriteState time.Duration
+
+	// Number of actors the state was written to.
+	Actors int
+}
+
+// A TickObserver is notified with the measurements made
+// while running the phases on the quad tree and then
+// with the measurements of the whole tick.
+type TickObserver interface {
+	quad.PhaseObserver
+	ObserveTick(TickMetrics)
+}
+
+// A Histogram records the distribution of int64 values.
+// Values are collected into buckets that are powers
+// of 2 so the memory used is constant.
+type Histogram struct {
+	mu sync.Mutex
+
+	buckets [64]uint64
+
+	count    uint64
+	sum      int64
+	min, max int64
+}
+
+func (h *Histogram) Record(v int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+
+	h.count++
+	h.sum += v
+
+	if v < 0 {
+		v = 0
+	}
+	h.buckets[bits.Len64(uint64(v))]++
+}
+
+func (h *Histogram) RecordDuration(d time.Duration) {
+	h.Record(int64(d))
+}
+
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) Sum() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sum
+}
+
+func (h *Histogram) Min() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+func (h *Histogram) Max() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+func (h *Histogram) Mean() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+	return float64(h.sum) / float64(h.count)
+}
+
+// Returns an upper bound of the value at quantile q,
+// where q is between 0 and 1. The value returned is the
+// largest value that fits in the bucket the quantile
+// falls in, but never larger than the maximum value.
+func (h *Histogram) Quantile(q float64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, n := range h.buckets {
+		seen += n
+		if seen < rank {
+			continue
+		}
+
+		var upper int64 = math.MaxInt64
+		if i < 63 {
+			upper = int64(1)<<uint(i) - 1
+		}
+
+		if upper > h.max {
+			return h.max
+		}
+		return upper
+	}
+
+	return h.max
+}
+
+// A MetricsRecorder is a TickObserver that
+// records every measurement into a Histogram.
+type MetricsRecorder struct {
+	Update Histogram
+	Input  Histogram
+	Broad  Histogram
+	Narrow Histogram
+
+	CollisionGroups Histogram
+	Inserted        Histogram
+	Removed         Histogram
+
+	Tick       Histogram
+	WriteState Histogram
+}
+
+func NewMetricsRecorder() *MetricsRecorder {
+	return &MetricsRecorder{}
+}
+
+func (r *MetricsRecorder) ObservePhases(m quad.PhaseMetrics) {
+	r.Update.RecordDuration(m.Update)
+	r.Input.RecordDuration(m.Input)
+	r.Broad.RecordDuration(m.Broad)
+	r.Narrow.RecordDuration(m.Narrow)
+
+	r.CollisionGroups.Record(int64(m.CollisionGroups))
+	r.Inserted.Record(int64(m.Inserted))
+	r.Removed.Record(int64(m.Removed))
+}
+
+func (r *MetricsRecorder) ObserveTick(m TickMetrics) {
+	r.Tick.RecordDuration(m.Duration)
+	r.WriteState.RecordDuration(m.WriteState)
+}
@@ -0,0 +1,38 @@
+package rpg2d_test
+
+import (
+	"github.com/ghthor/filu/rpg2d"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func DescribeHistogram(c gospec.Context) {
+	c.Specify("an empty histogram", func() {
+		var h rpg2d.Histogram
+		c.Expect(h.Count(), Equals, uint64(0))
+		c.Expect(h.Mean(), Equals, float64(0))
+		c.Expect(h.Quantile(0.5), Equals, int64(0))
+	})
+
+	c.Specify("a histogram", func() {
+		var h rpg2d.Histogram
+		for i := int64(1); i <= 100; i++ {
+			h.Record(i)
+		}
+
+		c.Specify("will track the count, sum, min and max", func() {
+			c.Expect(h.Count(), Equals, uint64(100))
+			c.Expect(h.Sum(), Equals, int64(5050))
+			c.Expect(h.Min(), Equals, int64(1))
+			c.Expect(h.Max(), Equals, int64(100))
+			c.Expect(h.Mean(), Equals, 50.5)
+		})
+
+		c.Specify("will return an upper bound for a quantile", func() {
+			c.Expect(h.Quantile(0.5), Equals, int64(63))
+			c.Expect(h.Quantile(0.01), Equals, int64(1))
+			c.Expect(h.Quantile(1), Equals, int64(100))
+		})
+	})
+}
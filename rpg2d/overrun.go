@@ -0,0 +1,164 @@
+package rpg2d
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// An OverrunPolicy decides what the simulation will do
+// when it has fallen behind the ticks delivered by its
+// TickSource. This happens when calculating a tick and
+// writing the state to all the actors takes longer
+// than the period of a frame.
+type OverrunPolicy int
+
+const (
+	// The clock will advance by a single frame for every
+	// tick that is calculated. The frames that were missed
+	// are never calculated so the clock will run slower
+	// than wall time while the simulation is behind.
+	OverrunSlowClock OverrunPolicy = iota
+
+	// The clock will jump forward to the frame that
+	// matches wall time and a single tick is calculated.
+	// The frames that were missed are never calculated.
+	OverrunSkipFrames
+
+	// Every frame that was missed will be calculated
+	// before the simulation continues. If more than
+	// MaxCatchUpTicks frames are behind, the oldest
+	// frames are skipped.
+	OverrunCatchUp
+)
+
+const defaultMaxCatchUpTicks = 5
+
+// TickStats are the measurements the simulation
+// has made while calculating ticks.
+type TickStats struct {
+	// Number of ticks that have been calculated
+	Ticks uint64
+
+	// Number of ticks that took longer
+	// than the period of a frame to calculate
+	Overruns uint64
+
+	// Number of frames the clock jumped over
+	// without calculating a tick
+	SkippedFrames uint64
+
+	// Number of extra ticks that were calculated
+	// to catch the clock up with wall time
+	CatchUpTicks uint64
+
+	LastTickDuration  time.Duration
+	MaxTickDuration   time.Duration
+	TotalTickDuration time.Duration
+}
+
+type tickStats struct {
+	mu    sync.Mutex
+	stats TickStats
+}
+
+func (s *tickStats) recordTick(d, period time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Ticks++
+	if d > period {
+		s.stats.Overruns++
+	}
+
+	s.stats.LastTickDuration = d
+	s.stats.TotalTickDuration += d
+	if d > s.stats.MaxTickDuration {
+		s.stats.MaxTickDuration = d
+	}
+}
+
+func (s *tickStats) recordFrames(skipped int64, ticks int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.SkippedFrames += uint64(skipped)
+	if ticks > 1 {
+		s.stats.CatchUpTicks += uint64(ticks - 1)
+	}
+}
+
+func (s *tickStats) snapshot() TickStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// A tickPacer maps the times delivered by a Ticker
+// to the frame the clock should be on at that time.
+type tickPacer struct {
+	policy     OverrunPolicy
+	maxCatchUp int
+	period     time.Duration
+
+	started bool
+
+	// The wall time of epochClock
+	epoch      time.Time
+	epochClock stime.Clock
+}
+
+func newTickPacer(policy OverrunPolicy, maxCatchUp int, period time.Duration) *tickPacer {
+	if maxCatchUp <= 0 {
+		maxCatchUp = defaultMaxCatchUpTicks
+	}
+
+	return &tickPacer{
+		policy:     policy,
+		maxCatchUp: maxCatchUp,
+		period:     period,
+	}
+}
+
+// Forget the wall time the clock was following. The
+// next tick will be treated as if it were on time.
+func (p *tickPacer) reset() {
+	p.started = false
+}
+
+func (p *tickPacer) rebase(clock stime.Clock, t time.Time) {
+	p.epoch = t.Add(-p.period)
+	p.epochClock = clock
+}
+
+// Returns the number of frames the clock should skip over
+// and then the number of ticks that should be calculated
+// for a tick that was delivered at time t.
+func (p *tickPacer) advance(clock stime.Clock, t time.Time) (skipped int64, ticks int) {
+	if !p.started {
+		p.started = true
+		p.rebase(clock, t)
+	}
+
+	target := int64(p.epochClock) + int64(t.Sub(p.epoch)/p.period)
+	behind := target - int64(clock)
+	if behind <= 1 {
+		return 0, 1
+	}
+
+	switch p.policy {
+	case OverrunSkipFrames:
+		return behind - 1, 1
+
+	case OverrunCatchUp:
+		if behind > int64(p.maxCatchUp) {
+			return behind - int64(p.maxCatchUp), p.maxCatchUp
+		}
+		return 0, int(behind)
+
+	default:
+		p.rebase(clock, t)
+		return 0, 1
+	}
+}
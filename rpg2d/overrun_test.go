@@ -0,0 +1,73 @@
+package rpg2d
+
+import (
+	"time"
+
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func DescribeTickPacer(c gospec.Context) {
+	period := 25 * time.Millisecond
+	start := time.Unix(0, 0)
+
+	at := func(frame int) time.Time {
+		return start.Add(time.Duration(frame) * period)
+	}
+
+	type advance struct {
+		skipped int64
+		ticks   int
+	}
+
+	// Returns the clock after every tick delivered at the
+	// given frames has been calculated by the pacer
+	run := func(p *tickPacer, frames ...int) (stime.Clock, []advance) {
+		clock := stime.Clock(0)
+		var advances []advance
+
+		for _, f := range frames {
+			skipped, ticks := p.advance(clock, at(f))
+			advances = append(advances, advance{skipped, ticks})
+			clock = stime.Clock(int64(clock) + skipped + int64(ticks))
+		}
+
+		return clock, advances
+	}
+
+	c.Specify("a tick pacer", func() {
+		c.Specify("will calculate a single tick when on time", func() {
+			for _, policy := range []OverrunPolicy{OverrunSlowClock, OverrunSkipFrames, OverrunCatchUp} {
+				clock, advances := run(newTickPacer(policy, 0, period), 1, 2, 3, 4)
+				c.Expect(clock, Equals, stime.Clock(4))
+				c.Expect(advances, ContainsExactly, []advance{{0, 1}, {0, 1}, {0, 1}, {0, 1}})
+			}
+		})
+
+		c.Specify("will slow the clock when behind", func() {
+			clock, advances := run(newTickPacer(OverrunSlowClock, 0, period), 1, 4, 5)
+			c.Expect(clock, Equals, stime.Clock(3))
+			c.Expect(advances, ContainsExactly, []advance{{0, 1}, {0, 1}, {0, 1}})
+		})
+
+		c.Specify("will skip frames when behind", func() {
+			clock, advances := run(newTickPacer(OverrunSkipFrames, 0, period), 1, 4, 5)
+			c.Expect(clock, Equals, stime.Clock(5))
+			c.Expect(advances, ContainsExactly, []advance{{0, 1}, {2, 1}, {0, 1}})
+		})
+
+		c.Specify("will catch up when behind", func() {
+			clock, advances := run(newTickPacer(OverrunCatchUp, 0, period), 1, 4, 5)
+			c.Expect(clock, Equals, stime.Clock(5))
+			c.Expect(advances, ContainsExactly, []advance{{0, 1}, {0, 3}, {0, 1}})
+		})
+
+		c.Specify("will only catch up a maximum number of ticks", func() {
+			clock, advances := run(newTickPacer(OverrunCatchUp, 2, period), 1, 6, 7)
+			c.Expect(clock, Equals, stime.Clock(7))
+			c.Expect(advances, ContainsExactly, []advance{{0, 1}, {3, 2}, {0, 1}})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package quad_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// Creates n entities that are all crowded into a
+// square in the center of the quad tree like the
+// players in a town square. Every entity overlaps
+// its neighbors, forming 1 large collision group.
+func crowdedEntities(n int) []entity.Entity {
+	const width = 16
+
+	entities := make([]entity.Entity, 0, n)
+	for i := 0; i < n; i++ {
+		cell := coord.Cell{i%width - width/2, width/2 - (i/width)%width}
+		entities = append(entities, entitytest.MockEntityWithBounds{
+			EntityId:   entity.Id(i),
+			EntityCell: cell,
+			EntityBounds: coord.Bounds{
+				TopL: cell,
+				BotR: coord.Cell{cell.X + 1, cell.Y - 1},
+			},
+		})
+	}
+
+	return entities
+}
+
+func benchmarkBroadPhase(b *testing.B, entities []entity.Entity) {
+	q, err := quad.New(coord.Bounds{
+		TopL: coord.Cell{-32, 32},
+		BotR: coord.Cell{31, -31},
+	}, 8, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, e := range entities {
+		q = q.Insert(e)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		quad.RunBroadPhaseOn(q, stime.Time(0))
+	}
+}
+
+func BenchmarkBroadPhaseDense1000(b *testing.B) {
+	benchmarkBroadPhase(b, denseEntities(1000))
+}
+
+func BenchmarkBroadPhaseCrowded256(b *testing.B) {
+	benchmarkBroadPhase(b, crowdedEntities(256))
+}
+
+func BenchmarkBroadPhaseCrowded1000(b *testing.B) {
+	benchmarkBroadPhase(b, crowdedEntities(1000))
+}
+
+// Builds a collision group from a chain of n collisions
+// between the crowded entities with AddCollision.
+// Compare with BenchmarkCollisionGroupUnionAddCollision.
+func BenchmarkCollisionGroupAddCollision(b *testing.B) {
+	for _, n := range []int{16, 256, 1000} {
+		entities := crowdedEntities(n + 1)
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var cg quad.CollisionGroup
+				for j := 1; j < len(entities); j++ {
+					cg = cg.AddCollision(quad.Collision{entities[j-1], entities[j]})
+				}
+			}
+		})
+	}
+}
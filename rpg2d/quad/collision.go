@@ -56,6 +56,57 @@ type CollisionGroup struct {
 	Collisions []Collision
 }
 
+// A set of the entities and collisions in a collision group,
+// used by the broad phase to add collisions in constant time.
+type collisionGroupSet struct {
+	entities   map[entity.Entity]struct{}
+	collisions map[Collision]struct{}
+}
+
+func newCollisionGroupSet(cg CollisionGroup) *collisionGroupSet {
+	set := &collisionGroupSet{
+		entities:   make(map[entity.Entity]struct{}, len(cg.Entities)),
+		collisions: make(map[Collision]struct{}, len(cg.Collisions)),
+	}
+
+	for _, e := range cg.Entities {
+		set.entities[e] = struct{}{}
+	}
+
+	for _, c := range cg.Collisions {
+		set.collisions[c] = struct{}{}
+	}
+
+	return set
+}
+
+func (set collisionGroupSet) hasCollision(c Collision) bool {
+	if _, exists := set.collisions[c]; exists {
+		return true
+	}
+
+	_, exists := set.collisions[Collision{c.B, c.A}]
+	return exists
+}
+
+// Adds the collision to the group and the set, which
+// must contain the group's entities and collisions.
+func (set *collisionGroupSet) addCollision(cg *CollisionGroup, c Collision) {
+	if set.hasCollision(c) {
+		return
+	}
+
+	cg.Collisions = append(cg.Collisions, c)
+	set.collisions[c] = struct{}{}
+
+	for _, e := range [2]entity.Entity{c.A, c.B} {
+		if _, exists := set.entities[e]; !exists {
+			cg.Entities = append(cg.Entities, e)
+			set.entities[e] = struct{}{}
+		}
+	}
+}
+
 func (cg CollisionGroup) Bounds() coord.Bounds {
 	bounds := make([]coord.Bounds, 0, len(cg.Collisions))
 	for _, c := range cg.Collisions {
@@ -74,6 +125,13 @@ func (cg CollisionGroup) CollisionIndex() CollisionIndex {
 // entities from the collision to the entities slice.
 // Filters out collisions it already has and entities
 // that are already in the entities slice.
+//
+// AddCollision is linear in the size of the group. A
+// CollisionGroup is a plain value that is copied and built
+// with struct literals, so it doesn't carry an index that
+// every copy would have to keep in sync. The broad phase
+// keeps its own set for each large group and adds to it in
+// constant time, see BenchmarkCollisionGroupUnionAddCollision.
 func (cg CollisionGroup) AddCollision(c Collision) CollisionGroup {
 	for _, cc := range cg.Collisions {
 		if c.IsSameAs(cc) {
@@ -0,0 +1,33 @@
+package quad
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+)
+
+// Builds a collision group from a chain of n collisions with
+// the broad phase's union, which adds the collisions to a set
+// once the group is large. Compare with the linear search of
+// BenchmarkCollisionGroupAddCollision.
+func BenchmarkCollisionGroupUnionAddCollision(b *testing.B) {
+	for _, n := range []int{16, 256, 1000} {
+		entities := make([]entity.Entity, 0, n+1)
+		for i := 0; i <= n; i++ {
+			entities = append(entities, entitytest.MockEntity{EntityId: entity.Id(i)})
+		}
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var merged collisionGroupUnion
+
+				cg := &CollisionGroup{}
+				for j := 1; j < len(entities); j++ {
+					merged.addCollision(cg, Collision{entities[j-1], entities[j]})
+				}
+			}
+		})
+	}
+}
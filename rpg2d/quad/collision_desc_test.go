@@ -232,6 +232,35 @@ func DescribeCollisionGroup(c gospec.Context) {
 			c.Expect(len(cg.Collisions), Equals, 4)
 		})
 
+		c.Specify("will not add a collision it already has if created by a literal", func() {
+			cg := quad.CollisionGroup{
+				Entities:   cgroups[0].Entities,
+				Collisions: cgroups[0].Collisions,
+			}
+
+			cg = cg.AddCollision(quad.Collision{collisions[1].B, collisions[1].A})
+			c.Expect(len(cg.Entities), Equals, 3)
+			c.Expect(len(cg.Collisions), Equals, 3)
+		})
+
+		c.Specify("can be copied and added to independently", func() {
+			cg := newcg(collisions[0])
+
+			cg1 := cg.AddCollision(collisions[1])
+			cg2 := cg.AddCollision(collisions[3])
+
+			c.Expect(cg1, Equals, newcg(collisions[:2]...))
+			c.Expect(cg2, Equals, newcg(collisions[0], collisions[3]))
+
+			cg1 = cg1.AddCollision(collisions[3])
+			c.Expect(len(cg1.Entities), Equals, 5)
+			c.Expect(len(cg1.Collisions), Equals, 3)
+
+			cg = cg.AddCollision(collisions[3])
+			c.Expect(len(cg.Entities), Equals, 4)
+			c.Expect(len(cg.Collisions), Equals, 2)
+		})
+
 		c.Specify("has a list of the entities involved in the group", func() {
 			for _, cg := range cgroups {
 				for _, collision := range cg.Collisions {
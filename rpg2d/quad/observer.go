@@ -0,0 +1,134 @@
+package quad
+
+import (
+	"time"
+
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// PhaseMetrics are the measurements made while
+// running all of the phases on a quad tree.
+type PhaseMetrics struct {
+	Now stime.Time
+
+	Update time.Duration
+	Input  time.Duration
+	Broad  time.Duration
+	Narrow time.Duration
+
+	// Number of collision groups created
+	// by the broad phase.
+	CollisionGroups int
+
+	// Number of entities inserted into the quad
+	// tree after being resolved by the narrow phase.
+	Inserted int
+
+	// Number of entities removed from the quad tree
+	// by the update phase and the narrow phase.
+	Removed int
+}
+
+// A PhaseObserver is notified with the measurements
+// made every time the phases have been run on a quad tree.
+type PhaseObserver interface {
+	ObservePhases(PhaseMetrics)
+}
+
+// Convenience type so phase observers can be
+// written as closures or as functions.
+type PhaseObserverFn func(PhaseMetrics)
+
+func (f PhaseObserverFn) ObservePhases(m PhaseMetrics) {
+	f(m)
+}
+
+// Run all of the phases on the quad tree and notify
+// the observer with the measurements that were made.
+// The observer can be nil.
+func RunObservedPhasesOn(
+	q Quad,
+	updatePhase UpdatePhaseHandler,
+	inputPhase InputPhaseHandler,
+	narrowPhase NarrowPhaseHandler,
+	now stime.Time,
+	observer PhaseObserver) Quad {
+
+	return RunPhasesWithOptionsOn(q, updatePhase, inputPhase, narrowPhase, now, observer, PhaseOptions{})
+}
+
+// PhaseOptions change how the internal phases are calculated.
+// The zero value calculates every phase serially.
+type PhaseOptions struct {
+	// Calculate the broad phase of the quad tree's
+	// children concurrently with RunParallelBroadPhaseOn.
+	ParallelBroadPhase bool
+
+	// When > 1 and the narrow phase handler is concurrency
+	// safe the collision groups are resolved by a pool of
+	// workers with RunParallelNarrowPhaseOn.
+	NarrowPhaseWorkers int
+}
+
+func (o PhaseOptions) runBroadPhaseOn(q Quad, now stime.Time) []*CollisionGroup {
+	if o.ParallelBroadPhase {
+		cgroups, _, _ := RunParallelBroadPhaseOn(q, now)
+		return cgroups
+	}
+
+	cgroups, _, _ := RunBroadPhaseOn(q, now)
+	return cgroups
+}
+
+// Run all of the phases on the quad tree with the options and
+// notify the observer with the measurements that were made.
+// The observer can be nil.
+func RunPhasesWithOptionsOn(
+	q Quad,
+	updatePhase UpdatePhaseHandler,
+	inputPhase InputPhaseHandler,
+	narrowPhase NarrowPhaseHandler,
+	now stime.Time,
+	observer PhaseObserver,
+	opts PhaseOptions) Quad {
+
+	if observer == nil {
+		q, _, _ = RunUpdatePhaseOn(q, updatePhase, now)
+		q, _ = RunInputPhaseOn(q, inputPhase, now)
+		cgroups := opts.runBroadPhaseOn(q, now)
+		q, _, _ = runNarrowPhase(q, cgroups, narrowPhase, now, opts.NarrowPhaseWorkers)
+		return q
+	}
+
+	m := PhaseMetrics{Now: now}
+
+	var removed []entity.Entity
+
+	start := time.Now()
+	if root, isRoot := q.(quadRoot); isRoot {
+		q, removed = root.runUpdatePhaseRemoving(updatePhase, now)
+	} else {
+		q, _, removed = RunUpdatePhaseOn(q, updatePhase, now)
+	}
+	m.Update = time.Since(start)
+
+	start = time.Now()
+	q, _ = RunInputPhaseOn(q, inputPhase, now)
+	m.Input = time.Since(start)
+
+	start = time.Now()
+	cgroups := opts.runBroadPhaseOn(q, now)
+	m.Broad = time.Since(start)
+
+	start = time.Now()
+	q, m.Inserted, m.Removed = runNarrowPhase(q, cgroups, narrowPhase, now, opts.NarrowPhaseWorkers)
+	m.Narrow = time.Since(start)
+
+	m.CollisionGroups = len(cgroups)
+	m.Removed += len(removed)
+
+	observer.ObservePhases(m)
+
+	return q
+}
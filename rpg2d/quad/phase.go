@@ -2,6 +2,8 @@ package quad
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/ghthor/filu/rpg2d/entity"
 	"github.com/ghthor/filu/sim/stime"
@@ -76,6 +78,8 @@ func (f InputPhaseHandlerFn) ApplyInputsTo(e entity.Entity, now stime.Time) []en
 // The user implementation should also be
 // where movement actions are accepted
 // and an entities position is modified.
+// SolveCollisionGroup can be used to resolve the
+// collisions in the order they depend on each other.
 type NarrowPhaseHandler interface {
 	ResolveCollisions(*CollisionGroup, stime.Time) (entities []entity.Entity, removed []entity.Entity)
 }
@@ -88,6 +92,31 @@ func (f NarrowPhaseHandlerFn) ResolveCollisions(cgrp *CollisionGroup, now stime.
 	return f(cgrp, now)
 }
 
+// A narrow phase handler that declares it is safe to resolve
+// multiple collision groups concurrently. Collision groups can't
+// interact with each other, but the handler must not modify any
+// state that is shared between the groups without synchronization.
+type ConcurrentNarrowPhaseHandler interface {
+	NarrowPhaseHandler
+	ConcurrencySafe() bool
+}
+
+// Convenience type so concurrency safe narrow phase
+// handlers can be written as closures or as functions.
+type ConcurrentNarrowPhaseHandlerFn func(*CollisionGroup, stime.Time) ([]entity.Entity, []entity.Entity)
+
+func (f ConcurrentNarrowPhaseHandlerFn) ResolveCollisions(cgrp *CollisionGroup, now stime.Time) ([]entity.Entity, []entity.Entity) {
+	return f(cgrp, now)
+}
+
+func (ConcurrentNarrowPhaseHandlerFn) ConcurrencySafe() bool { return true }
+
+// Returns true if the handler has declared it is concurrency safe.
+func IsConcurrencySafe(h NarrowPhaseHandler) bool {
+	ch, ok := h.(ConcurrentNarrowPhaseHandler)
+	return ok && ch.ConcurrencySafe()
+}
+
 func RunPhasesOn(
 	q Quad,
 	updatePhase UpdatePhaseHandler,
@@ -95,12 +124,7 @@ func RunPhasesOn(
 	narrowPhase NarrowPhaseHandler,
 	now stime.Time) Quad {
 
-	q, _, _ = RunUpdatePhaseOn(q, updatePhase, now)
-	q, _ = RunInputPhaseOn(q, inputPhase, now)
-	cgroups, _, _ := RunBroadPhaseOn(q, now)
-	q, _ = RunNarrowPhaseOn(q, cgroups, narrowPhase, now)
-
-	return q
+	return RunObservedPhasesOn(q, updatePhase, inputPhase, narrowPhase, now, nil)
 }
 
 func RunUpdatePhaseOn(q Quad, updatePhase UpdatePhaseHandler, now stime.Time) (Quad, []entity.Entity, []entity.Entity) {
@@ -122,18 +146,111 @@ func RunBroadPhaseOn(
 	return q.runBroadPhase(now)
 }
 
+// The depth of the quad tree the parallel broad phase will
+// calculate concurrently. A depth of 2 will use up to 16
+// go routines for the children of the root's children.
+const parallelBroadPhaseDepth = 2
+
+// Calculates the broad phase of the children of the quad tree
+// concurrently. The collision groups are identical to RunBroadPhaseOn.
+func RunParallelBroadPhaseOn(
+	q Quad,
+	now stime.Time) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex) {
+
+	return q.runParallelBroadPhase(now, parallelBroadPhaseDepth)
+}
+
 func RunNarrowPhaseOn(
 	q Quad,
 	cgroups []*CollisionGroup,
 	narrowPhase NarrowPhaseHandler,
 	now stime.Time) (Quad, []entity.Entity) {
 
+	q, _, _ = runNarrowPhase(q, cgroups, narrowPhase, now, 1)
+	return q, nil
+}
+
+// Resolves the collision groups with a pool of workers when the
+// handler is concurrency safe, otherwise the groups are resolved
+// serially. The entities are inserted and removed in the order of
+// the collision groups, so the quad tree is identical to RunNarrowPhaseOn.
+func RunParallelNarrowPhaseOn(
+	q Quad,
+	cgroups []*CollisionGroup,
+	narrowPhase NarrowPhaseHandler,
+	now stime.Time,
+	workers int) (Quad, []entity.Entity) {
+
+	q, _, _ = runNarrowPhase(q, cgroups, narrowPhase, now, workers)
+	return q, nil
+}
+
+// The entities returned by the narrow phase for 1 collision group
+type narrowPhaseResult struct {
+	existing, removed []entity.Entity
+}
+
+// Resolve every collision group with a pool of workers.
+// The results are in the same order as the collision groups.
+func resolveConcurrently(
+	cgroups []*CollisionGroup,
+	narrowPhase NarrowPhaseHandler,
+	now stime.Time,
+	workers int) []narrowPhaseResult {
+
+	results := make([]narrowPhaseResult, len(cgroups))
+
+	if workers > len(cgroups) {
+		workers = len(cgroups)
+	}
+
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				r := &results[i]
+				r.existing, r.removed = narrowPhase.ResolveCollisions(cgroups[i], now)
+			}
+		}()
+	}
+
+	for i := range cgroups {
+		next <- i
+	}
+	close(next)
+
+	wg.Wait()
+
+	return results
+}
+
+// Returns the number of entities that were
+// inserted and removed from the quad tree.
+func runNarrowPhase(
+	q Quad,
+	cgroups []*CollisionGroup,
+	narrowPhase NarrowPhaseHandler,
+	now stime.Time,
+	workers int) (quad Quad, inserted, removed int) {
+
 	var toBeInserted, toBeRemoved []entity.Entity
 
-	for _, cg := range cgroups {
-		existing, removed := narrowPhase.ResolveCollisions(cg, now)
-		toBeInserted = append(toBeInserted, existing...)
-		toBeRemoved = append(toBeRemoved, removed...)
+	if workers > 1 && len(cgroups) > 1 && IsConcurrencySafe(narrowPhase) {
+		for _, r := range resolveConcurrently(cgroups, narrowPhase, now, workers) {
+			toBeInserted = append(toBeInserted, r.existing...)
+			toBeRemoved = append(toBeRemoved, r.removed...)
+		}
+	} else {
+		for _, cg := range cgroups {
+			existing, removed := narrowPhase.ResolveCollisions(cg, now)
+			toBeInserted = append(toBeInserted, existing...)
+			toBeRemoved = append(toBeRemoved, removed...)
+		}
 	}
 
 	for _, e := range toBeRemoved {
@@ -144,10 +261,18 @@ func RunNarrowPhaseOn(
 		q = q.Insert(e)
 	}
 
-	return q, nil
+	return q, len(toBeInserted), len(toBeRemoved)
 }
 
 func (q quadRoot) runUpdatePhase(p UpdatePhaseHandler, now stime.Time) (quad Quad, remaining, removed []entity.Entity) {
+	quad, _ = q.runUpdatePhaseRemoving(p, now)
+	return quad, nil, nil
+}
+
+// Runs the update phase and returns the entities
+// that were removed from the quad tree.
+func (q quadRoot) runUpdatePhaseRemoving(p UpdatePhaseHandler, now stime.Time) (quad Quad, removed []entity.Entity) {
+	var remaining []entity.Entity
 	q.Quad, remaining, removed = q.Quad.runUpdatePhase(p, now)
 
 	quad = q
@@ -159,7 +284,7 @@ func (q quadRoot) runUpdatePhase(p UpdatePhaseHandler, now stime.Time) (quad Qua
 		quad = quad.Remove(e)
 	}
 
-	return quad, nil, nil
+	return quad, removed
 }
 
 func (q quadNode) runUpdatePhase(p UpdatePhaseHandler, now stime.Time) (quad Quad, remaining, removed []entity.Entity) {
@@ -228,9 +353,55 @@ func (q quadLeaf) runInputPhase(p InputPhaseHandler, now stime.Time) (Quad, []en
 // Broad phase is non-mutative and therefor doesn't
 // require a method on the quadRoot type.
 
+// The result of the broad phase of 1 quad
+type broadPhaseResult struct {
+	cgroups  []*CollisionGroup
+	solved   CollisionGroupIndex
+	unsolved CollisionGroupIndex
+}
+
 func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex) {
-	for _, cq := range q.children {
-		cgrps, s, u := cq.runBroadPhase(now)
+	var results [4]broadPhaseResult
+	for i, cq := range q.children {
+		r := &results[i]
+		r.cgroups, r.solved, r.unsolved = cq.runBroadPhase(now)
+	}
+
+	return q.joinBroadPhase(results)
+}
+
+// Calculates the broad phase of the children concurrently. The
+// children of the children are calculated concurrently until
+// depth reaches 1. The results are joined in the same order
+// as runBroadPhase so the collision groups are identical.
+func (q quadNode) runParallelBroadPhase(now stime.Time, depth int) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex) {
+	var results [4]broadPhaseResult
+
+	var wg sync.WaitGroup
+	wg.Add(len(q.children))
+
+	for i, cq := range q.children {
+		go func(r *broadPhaseResult, cq Quad) {
+			defer wg.Done()
+
+			if depth > 1 {
+				r.cgroups, r.solved, r.unsolved = cq.runParallelBroadPhase(now, depth-1)
+			} else {
+				r.cgroups, r.solved, r.unsolved = cq.runBroadPhase(now)
+			}
+		}(&results[i], cq)
+	}
+
+	wg.Wait()
+
+	return q.joinBroadPhase(results)
+}
+
+// Joins the results of the children's broad phases and
+// solves the entities that bubbled up from the children.
+func (q quadNode) joinBroadPhase(results [4]broadPhaseResult) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex) {
+	for _, r := range results {
+		cgrps, s, u := r.cgroups, r.solved, r.unsolved
 
 		// Join array of collision groups
 		cgroups = append(cgroups, cgrps...)
@@ -255,9 +426,21 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 		}
 	}
 
+	// Solve the entities in a consistent order so
+	// the collision groups are always the same
+	bubbled := make([]entity.Entity, 0, len(unsolved))
+	for e := range unsolved {
+		bubbled = append(bubbled, e)
+	}
+	sort.Slice(bubbled, func(i, j int) bool { return bubbled[i].Id() < bubbled[j].Id() })
+
+	var merged collisionGroupUnion
+
 	// For each entity in the unsolved array
 	// try to solve it by querying the children
-	for e1, e1cg := range unsolved {
+	for _, e1 := range bubbled {
+		e1cg := merged.find(unsolved[e1])
+
 		if b, _ := q.Bounds().Intersection(e1.Bounds()); b != e1.Bounds() {
 			// The entities bounds extend beyond the quad tree's bounds
 			// and therefore we can't solve this entity here either
@@ -277,6 +460,7 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 			}
 
 			e2cg, e2cgExist := solved[e2]
+			e2cg = merged.find(e2cg)
 
 			switch {
 			case e1cg == nil && !e2cgExist:
@@ -285,14 +469,15 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 
 				// create a new collision group
 				// and add a collision for e1 & e2
-				cg := CollisionGroup{}.AddCollision(Collision{e1, e2})
+				cg := &CollisionGroup{}
+				merged.addCollision(cg, Collision{e1, e2})
 
 				// add this new collision group to the array of collision groups
-				cgroups = append(cgroups, &cg)
+				cgroups = append(cgroups, cg)
 
 				// set e1 & e2's new collision group
-				solved[e1] = &cg
-				solved[e2] = &cg
+				solved[e1] = cg
+				solved[e2] = cg
 
 				// set e1's collision group in the for loop
 				// over the unsolved map.
@@ -300,12 +485,12 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 				// of this this outer loop just yet and
 				// further iterations must know that e1
 				// is now part of a collision group.
-				e1cg = &cg
+				e1cg = cg
 
 				// NOTE I don't know if this is necessary
 				// due to the inverse reason that the above
 				// statement is required.
-				unsolved[e1] = &cg
+				unsolved[e1] = cg
 
 			case e1cg != nil && !e2cgExist:
 				// e1 is in a collision group
@@ -314,7 +499,7 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 
 				// create a new collision of e1 & e2
 				// add it to e1's collision group
-				*cg = cg.AddCollision(Collision{e1, e2})
+				merged.addCollision(cg, Collision{e1, e2})
 
 				// and set e2's collision group in the collision group index
 				solved[e2] = cg
@@ -324,7 +509,7 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 				// e2 is in a collision group
 
 				// add a collision for e1 & e2 to e2's collision group
-				*e2cg = e2cg.AddCollision(Collision{e1, e2})
+				merged.addCollision(e2cg, Collision{e1, e2})
 
 				// set e1's collision group
 				solved[e1] = e2cg
@@ -348,37 +533,11 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 				// The collision groups are different
 
 				// merge the collision groups into e1's collision group
-				for _, c := range e2cg.Collisions {
-					*e1cg = e1cg.AddCollision(c)
-				}
+				merged.union(e1cg, e2cg)
 
 				// create a collision for e1 & e2
 				// add it to the collision group
-				*e1cg = e1cg.AddCollision(Collision{e1, e2})
-
-				// set e2's new collision group and
-				// remove e2's old collision group from the cgindex
-				for e, cg := range solved {
-					if cg == e2cg {
-						solved[e] = e1cg
-					}
-				}
-
-				// set e2's new collision group and
-				// remove e2's old collision group from the cgindex
-				for e, cg := range unsolved {
-					if cg == e2cg {
-						unsolved[e] = e1cg
-					}
-				}
-
-				// remove e2's collision group from the array
-				for i, cg := range cgroups {
-					if cg == e2cg {
-						cgroups = append(cgroups[:i], cgroups[i+1:]...)
-						break
-					}
-				}
+				merged.addCollision(e1cg, Collision{e1, e2})
 
 			case e1cg != nil && e2cgExist && e1cg == e2cg:
 				// e1 and e2 exist in the same collision group
@@ -395,9 +554,121 @@ func (q quadNode) runBroadPhase(now stime.Time) (cgroups []*CollisionGroup, solv
 		delete(unsolved, e1)
 	}
 
+	// Remove the collision groups that have been merged
+	// and set every entity's group to the merged group
+	cgroups = merged.resolve(cgroups, solved, unsolved)
+
 	return cgroups, solved, unsolved
 }
 
+// A union-find of the collision groups that have been merged into
+// other groups during a broad phase. An entity's group is found
+// through the union instead of reassigning every entity in the
+// index when 2 groups are merged. The union also keeps a set of
+// the entities and collisions of each large group so a collision
+// can be added to it in constant time. The zero value is ready
+// to use and doesn't allocate until a group is merged or a
+// group becomes large.
+type collisionGroupUnion struct {
+	// Maps each merged group to the group it was merged into
+	merged map[*CollisionGroup]*CollisionGroup
+
+	// The sets of the large groups collisions have been added to
+	sets map[*CollisionGroup]*collisionGroupSet
+}
+
+// The number of collisions a group can have before the union
+// keeps a set for it. Until then AddCollision's linear search
+// of the group is faster than building and hashing into a set.
+const collisionGroupSetThreshold = 16
+
+// Returns the group the collision group has been merged into.
+func (u *collisionGroupUnion) find(cg *CollisionGroup) *CollisionGroup {
+	root := cg
+	for {
+		into, merged := u.merged[root]
+		if !merged {
+			break
+		}
+		root = into
+	}
+
+	// Compress the path to the root
+	for cg != root {
+		next := u.merged[cg]
+		u.merged[cg] = root
+		cg = next
+	}
+
+	return root
+}
+
+// Adds the collision to the group. The group's set is built the
+// first time a collision is added once the group is large,
+// including a large group from the broad phase of a child quad.
+func (u *collisionGroupUnion) addCollision(cg *CollisionGroup, c Collision) {
+	set, exists := u.sets[cg]
+	if !exists {
+		if len(cg.Collisions) < collisionGroupSetThreshold {
+			*cg = cg.AddCollision(c)
+			return
+		}
+
+		if u.sets == nil {
+			u.sets = make(map[*CollisionGroup]*collisionGroupSet)
+		}
+
+		set = newCollisionGroupSet(*cg)
+		u.sets[cg] = set
+	}
+
+	set.addCollision(cg, c)
+}
+
+// Merges the collisions of the group from into the group into.
+func (u *collisionGroupUnion) union(into, from *CollisionGroup) {
+	for _, c := range from.Collisions {
+		u.addCollision(into, c)
+	}
+
+	if u.merged == nil {
+		u.merged = make(map[*CollisionGroup]*CollisionGroup)
+	}
+
+	u.merged[from] = into
+	delete(u.sets, from)
+}
+
+// Removes the merged groups from the slice of collision groups,
+// keeping the order of the remaining groups, and sets the group
+// of every entity in the indexes to the group it was merged into.
+func (u *collisionGroupUnion) resolve(cgroups []*CollisionGroup, indexes ...CollisionGroupIndex) []*CollisionGroup {
+	if len(u.merged) == 0 {
+		return cgroups
+	}
+
+	remaining := cgroups[:0]
+	for _, cg := range cgroups {
+		if _, merged := u.merged[cg]; !merged {
+			remaining = append(remaining, cg)
+		}
+	}
+
+	for _, index := range indexes {
+		for e, cg := range index {
+			if cg != nil {
+				index[e] = u.find(cg)
+			}
+		}
+	}
+
+	return remaining
+}
+
+func (q quadLeaf) runParallelBroadPhase(now stime.Time, depth int) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex) {
+	return q.runBroadPhase(now)
+}
+
 func (q quadLeaf) runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex) {
 	if !(len(q.entities) > 0) {
 		return nil, nil, nil
@@ -406,6 +677,8 @@ func (q quadLeaf) runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved,
 	cgindex := make(map[entity.Entity]*CollisionGroup, len(q.entities))
 	cgroups = make([]*CollisionGroup, 0, len(q.entities))
 
+	var merged collisionGroupUnion
+
 	for _, e1 := range q.entities {
 		// TODO Add test cases for no collisions
 		// Ignore entities that have no collisions
@@ -430,13 +703,14 @@ func (q quadLeaf) runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved,
 
 			e1cg, e1cgExists := cgindex[e1]
 			e2cg, e2cgExists := cgindex[e2]
+			e1cg, e2cg = merged.find(e1cg), merged.find(e2cg)
 
 			switch {
 			case e1cgExists && !e2cgExists:
 				// e1 exists in a collision group already
 				// create a collision and add it to e1's group
 				c := Collision{e1, e2}
-				*e1cg = e1cg.AddCollision(c)
+				merged.addCollision(e1cg, c)
 
 				cgindex[e1] = e1cg
 				cgindex[e2] = e1cg
@@ -445,7 +719,7 @@ func (q quadLeaf) runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved,
 				// e2 exists in a collision group already
 				// create a collision and add it to e2's group
 				c := Collision{e1, e2}
-				*e2cg = e2cg.AddCollision(c)
+				merged.addCollision(e2cg, c)
 
 				cgindex[e1] = e2cg
 				cgindex[e2] = e2cg
@@ -454,12 +728,12 @@ func (q quadLeaf) runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved,
 				// neither e1 or e2 have been assigned to a collision group
 				// create a new collision group
 				cg := &CollisionGroup{
-					make([]entity.Entity, 0, 2),
-					make([]Collision, 0, 1),
+					Entities:   make([]entity.Entity, 0, 2),
+					Collisions: make([]Collision, 0, 1),
 				}
 
 				// add a collision between e1 and e2
-				*cg = cg.AddCollision(Collision{e1, e2})
+				merged.addCollision(cg, Collision{e1, e2})
 
 				// set the cgroup in the cgroup index
 				cgindex[e1] = cg
@@ -473,34 +747,15 @@ func (q quadLeaf) runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved,
 				// but those collision groups are different
 
 				// merge the collision groups
-				for _, c := range e2cg.Collisions {
-					*e1cg = e1cg.AddCollision(c)
-				}
+				merged.union(e1cg, e2cg)
 
 				// add a collision for e1 && e2
-				*e1cg = e1cg.AddCollision(Collision{e1, e2})
-
-				// set e2's new collision group and
-				// remove e2's old collision group from the cgindex
-				for e, cg := range cgindex {
-					if cg == e2cg {
-						cgindex[e] = e1cg
-					}
-				}
-
-				// remove e2's collision group from the array
-				for i, cg := range cgroups {
-					if cg == e2cg {
-						cgroups = append(cgroups[:i], cgroups[i+1:]...)
-						break
-					}
-				}
+				merged.addCollision(e1cg, Collision{e1, e2})
 
 			case (e1cgExists && e2cgExists) && (e1cg == e2cg):
 				// both entities exist in the same collision group already
 				// Add a collision for e1 && e2
-				cg := e1cg
-				*cg = cg.AddCollision(Collision{e1, e2})
+				merged.addCollision(e1cg, Collision{e1, e2})
 
 			default:
 				panic(fmt.Sprintf(`unexpected index state during broad phase
@@ -511,6 +766,10 @@ e2cg = %v
 		}
 	}
 
+	// Remove the collision groups that have been merged
+	// and set every entity's group to the merged group
+	cgroups = merged.resolve(cgroups, cgindex)
+
 	// Solved entities are in the cgindex
 	solved = cgindex
 	// Build a collision group index for the unsolvable entities
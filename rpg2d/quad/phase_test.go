@@ -2,7 +2,11 @@ package quad_test
 
 import (
 	"fmt"
+	"math/rand"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ghthor/filu/rpg2d/coord"
 	"github.com/ghthor/filu/rpg2d/entity"
@@ -141,6 +145,28 @@ func (e byId) Less(i, j int) bool {
 	return e[i].Id() < e[j].Id()
 }
 
+// Creates n entities with random bounds that are
+// densely packed into the area from (-32, 32) to (31, -31).
+// The same entities are created every time.
+func denseEntities(n int) []entity.Entity {
+	r := rand.New(rand.NewSource(1))
+
+	entities := make([]entity.Entity, 0, n)
+	for i := 0; i < n; i++ {
+		cell := coord.Cell{r.Intn(62) - 32, r.Intn(62) - 30}
+		entities = append(entities, entitytest.MockEntityWithBounds{
+			EntityId:   entity.Id(i),
+			EntityCell: cell,
+			EntityBounds: coord.Bounds{
+				TopL: cell,
+				BotR: coord.Cell{cell.X + r.Intn(2), cell.Y - r.Intn(2)},
+			},
+		})
+	}
+
+	return entities
+}
+
 func DescribePhase(c gospec.Context) {
 	e := func(id entity.Id, x, y int) entitytest.MockEntity {
 		return entitytest.MockEntity{
@@ -380,6 +406,159 @@ func DescribePhase(c gospec.Context) {
 		})
 	})
 
+	c.Specify("the parallel broad phase", func() {
+		q, err := quad.New(coord.Bounds{
+			TopL: coord.Cell{-32, 32},
+			BotR: coord.Cell{31, -31},
+		}, 4, nil)
+		c.Assume(err, IsNil)
+
+		for _, e := range denseEntities(1000) {
+			q = q.Insert(e)
+		}
+
+		// Describes the collision groups in the order
+		// they were created, including the order of
+		// the entities and collisions in each group.
+		describe := func(cgroups []*quad.CollisionGroup) []string {
+			desc := make([]string, 0, len(cgroups))
+			for _, cg := range cgroups {
+				desc = append(desc, fmt.Sprint(*cg))
+			}
+			return desc
+		}
+
+		serial, _, _ := quad.RunBroadPhaseOn(q, stime.Time(0))
+		parallel, _, _ := quad.RunParallelBroadPhaseOn(q, stime.Time(0))
+
+		c.Assume(len(serial) > 1, IsTrue)
+
+		c.Specify("will create the same collision groups as the serial broad phase", func() {
+			c.Expect(strings.Join(describe(parallel), "\n"), Equals, strings.Join(describe(serial), "\n"))
+		})
+
+		c.Specify("will create the same collision groups every time", func() {
+			again, _, _ := quad.RunParallelBroadPhaseOn(q, stime.Time(0))
+			c.Expect(strings.Join(describe(again), "\n"), Equals, strings.Join(describe(parallel), "\n"))
+		})
+	})
+
+	c.Specify("a broad phase of a crowd", func() {
+		q, err := quad.New(coord.Bounds{
+			TopL: coord.Cell{-32, 32},
+			BotR: coord.Cell{31, -31},
+		}, 4, nil)
+		c.Assume(err, IsNil)
+
+		entities := crowdedEntities(256)
+		for _, e := range entities {
+			q = q.Insert(e)
+		}
+
+		cgroups, _, _ := quad.RunBroadPhaseOn(q, stime.Time(0))
+
+		c.Specify("will create 1 collision group with every entity", func() {
+			c.Assume(len(cgroups), Equals, 1)
+			c.Expect(cgroups[0].Entities, ContainsExactly, entities)
+		})
+
+		c.Specify("will not have any duplicate collisions", func() {
+			c.Assume(len(cgroups), Equals, 1)
+
+			pairs := make(map[[2]entity.Id]bool)
+			for _, col := range cgroups[0].Collisions {
+				a, b := col.A.Id(), col.B.Id()
+				if b < a {
+					a, b = b, a
+				}
+				pairs[[2]entity.Id{a, b}] = true
+			}
+
+			c.Expect(len(pairs), Equals, len(cgroups[0].Collisions))
+		})
+	})
+
+	c.Specify("the parallel narrow phase", func() {
+		q, err := quad.New(coord.Bounds{
+			TopL: coord.Cell{-32, 32},
+			BotR: coord.Cell{31, -31},
+		}, 4, nil)
+		c.Assume(err, IsNil)
+
+		for _, e := range denseEntities(1000) {
+			q = q.Insert(e)
+		}
+
+		cgroups, _, _ := quad.RunBroadPhaseOn(q, stime.Time(0))
+		c.Assume(len(cgroups) > 1, IsTrue)
+
+		var mu sync.Mutex
+		var running, maxRunning int
+
+		// Moves every entity north and removes every 7th entity
+		resolve := func(cg *quad.CollisionGroup, now stime.Time) (entities, removed []entity.Entity) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			for _, e := range cg.Entities {
+				if e.Id()%7 == 0 {
+					removed = append(removed, e)
+					continue
+				}
+
+				moved := e.(entitytest.MockEntityWithBounds)
+				moved.EntityCell.Y++
+				moved.EntityBounds.TopL.Y++
+				moved.EntityBounds.BotR.Y++
+				entities = append(entities, moved)
+			}
+
+			time.Sleep(100 * time.Microsecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			return entities, removed
+		}
+
+		describe := func(q quad.Quad) string {
+			return fmt.Sprint(q.QueryBounds(q.Bounds()))
+		}
+
+		serial, _ := quad.RunNarrowPhaseOn(q, cgroups, quad.NarrowPhaseHandlerFn(resolve), stime.Time(0))
+		expected := describe(serial)
+
+		// The narrow phase modifies the quad tree
+		q, err = quad.New(q.Bounds(), 4, nil)
+		c.Assume(err, IsNil)
+
+		for _, e := range denseEntities(1000) {
+			q = q.Insert(e)
+		}
+
+		c.Specify("will resolve collision groups concurrently", func() {
+			maxRunning = 0
+			parallel, _ := quad.RunParallelNarrowPhaseOn(q, cgroups, quad.ConcurrentNarrowPhaseHandlerFn(resolve), stime.Time(0), 4)
+
+			c.Expect(describe(parallel), Equals, expected)
+			c.Expect(maxRunning > 1, IsTrue)
+			c.Expect(maxRunning <= 4, IsTrue)
+		})
+
+		c.Specify("will resolve collision groups serially if the handler isn't concurrency safe", func() {
+			maxRunning = 0
+			parallel, _ := quad.RunParallelNarrowPhaseOn(q, cgroups, quad.NarrowPhaseHandlerFn(resolve), stime.Time(0), 4)
+
+			c.Expect(describe(parallel), Equals, expected)
+			c.Expect(maxRunning, Equals, 1)
+		})
+	})
+
 	c.Specify("the narrow phase", func() {
 		q, err := quad.New(coord.Bounds{
 			TopL: coord.Cell{-16, 16},
@@ -422,4 +601,46 @@ func DescribePhase(c gospec.Context) {
 			c.Expect(q.QueryCell(cell(2, 0))[0].Id(), Equals, entity.Id(1))
 		})
 	})
+
+	c.Specify("running the phases with an observer", func() {
+		q, err := quad.New(coord.Bounds{
+			TopL: coord.Cell{-16, 16},
+			BotR: coord.Cell{15, -15},
+		}, 3, nil)
+		c.Assume(err, IsNil)
+
+		q = q.Insert(e(0, 0, 0))
+		q = q.Insert(e(1, 0, 0))
+		q = q.Insert(e(2, 5, 5))
+
+		var metrics []quad.PhaseMetrics
+
+		q = quad.RunObservedPhasesOn(q,
+			quad.UpdatePhaseHandlerFn(func(e entity.Entity, now stime.Time) entity.Entity {
+				if e.Id() == 2 {
+					return nil
+				}
+				return e
+			}),
+			quad.InputPhaseHandlerFn(func(e entity.Entity, now stime.Time) []entity.Entity {
+				return []entity.Entity{e}
+			}),
+			quad.NarrowPhaseHandlerFn(func(cg *quad.CollisionGroup, now stime.Time) ([]entity.Entity, []entity.Entity) {
+				return cg.Entities, nil
+			}),
+			stime.Time(3),
+			quad.PhaseObserverFn(func(m quad.PhaseMetrics) {
+				metrics = append(metrics, m)
+			}))
+
+		c.Assume(len(metrics), Equals, 1)
+
+		m := metrics[0]
+		c.Expect(m.Now, Equals, stime.Time(3))
+		c.Expect(m.CollisionGroups, Equals, 1)
+		c.Expect(m.Inserted, Equals, 2)
+		c.Expect(m.Removed, Equals, 1)
+
+		c.Expect(len(q.QueryBounds(q.Bounds())), Equals, 2)
+	})
 }
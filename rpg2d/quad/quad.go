@@ -34,6 +34,7 @@ type Quad interface {
 	runUpdatePhase(UpdatePhaseHandler, stime.Time) (quad Quad, remaining, removed []entity.Entity)
 	runInputPhase(InputPhaseHandler, stime.Time) (Quad, []entity.Entity)
 	runBroadPhase(stime.Time) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex)
+	runParallelBroadPhase(now stime.Time, depth int) (cgroups []*CollisionGroup, solved, unsolved CollisionGroupIndex)
 }
 
 // Guards against unspecified behavior if the maxSize is 1
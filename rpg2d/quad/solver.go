@@ -0,0 +1,113 @@
+package quad
+
+import "github.com/ghthor/filu/rpg2d/entity"
+
+// A CollisionSolver is used by SolveCollisionGroup to resolve
+// the collisions in a group in the order they depend on each other.
+//
+// A collision where A is moving into B depends on the other collisions
+// of B, except the collisions where another entity is moving into B.
+// Whether A can move into B can't be known until it is known if B can
+// move out of the way, so those collisions are resolved first.
+type CollisionSolver interface {
+	// Returns the entity that is moving into the other entity
+	// of the collision. A collision without a moving entity,
+	// like 2 entities racing into the same cell, doesn't
+	// depend on any other collision.
+	MovingEntity(Collision) (entity.Entity, bool)
+
+	// Resolve the collision. Every collision the collision depends
+	// on has been resolved, except if inCycle is true. Then the
+	// collision closes a cycle of collisions, A into B into C into A,
+	// and the collisions of the cycle that haven't been resolved yet
+	// depend on how this collision is resolved. They are resolved
+	// after this collision in the reverse order of their dependence.
+	ResolveCollision(c Collision, inCycle bool)
+}
+
+// The resolution state of a collision during a solve
+type solveState int
+
+const (
+	collisionUnsolved solveState = iota
+	collisionSolving
+	collisionSolved
+)
+
+// Resolve every collision in the group with the solver in the order
+// they depend on each other. ResolveCollision is called exactly once
+// for every collision. Collisions that don't depend on each other
+// are resolved in the order they are in the group.
+//
+// A cycle is solved starting from the collision of the cycle that
+// is first in the group's order. The collision that closes the cycle
+// is the collision of the cycle that depends on the first collision.
+func SolveCollisionGroup(cg CollisionGroup, solver CollisionSolver) {
+	s := collisionGroupSolver{
+		solver:     solver,
+		collisions: cg.Collisions,
+		states:     make([]solveState, len(cg.Collisions)),
+		targets:    make([]entity.Entity, len(cg.Collisions)),
+		involved:   make(map[entity.Entity][]int, len(cg.Entities)),
+	}
+
+	for i, c := range cg.Collisions {
+		s.involved[c.A] = append(s.involved[c.A], i)
+		s.involved[c.B] = append(s.involved[c.B], i)
+
+		mover, isMoving := solver.MovingEntity(c)
+		if !isMoving {
+			continue
+		}
+
+		if mover == c.A {
+			s.targets[i] = c.B
+		} else {
+			s.targets[i] = c.A
+		}
+	}
+
+	for i := range cg.Collisions {
+		if s.states[i] == collisionUnsolved {
+			s.solve(i)
+		}
+	}
+}
+
+type collisionGroupSolver struct {
+	solver     CollisionSolver
+	collisions []Collision
+	states     []solveState
+
+	// The entity each collision's moving entity is moving into
+	targets []entity.Entity
+
+	// The collisions each entity is involved in
+	involved map[entity.Entity][]int
+}
+
+// Recursively solves the collisions the collision
+// depends on and then resolves the collision.
+func (s collisionGroupSolver) solve(i int) {
+	s.states[i] = collisionSolving
+
+	var inCycle bool
+
+	if target := s.targets[i]; target != nil {
+		for _, j := range s.involved[target] {
+			switch {
+			case j == i:
+			case s.targets[j] == target:
+				// Another entity moving into the target
+				// doesn't change if the target can move
+			case s.states[j] == collisionUnsolved:
+				s.solve(j)
+			case s.states[j] == collisionSolving:
+				inCycle = true
+			}
+		}
+	}
+
+	s.solver.ResolveCollision(s.collisions[i], inCycle)
+	s.states[i] = collisionSolved
+}
@@ -0,0 +1,186 @@
+package quad_test
+
+import (
+	"fmt"
+
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/quad"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+// Records the order the collisions are resolved in as
+// "A into B", or "A and B" if neither is moving into
+// the other, with a "!" suffix if it's in a cycle.
+type mockCollisionSolver struct {
+	// The id of the entity each entity is moving into
+	movingInto map[entity.Id]entity.Id
+
+	resolved []string
+}
+
+func (s *mockCollisionSolver) MovingEntity(c quad.Collision) (entity.Entity, bool) {
+	switch {
+	case s.movingInto[c.A.Id()] == c.B.Id():
+		return c.A, true
+	case s.movingInto[c.B.Id()] == c.A.Id():
+		return c.B, true
+	}
+
+	return nil, false
+}
+
+func (s *mockCollisionSolver) ResolveCollision(c quad.Collision, inCycle bool) {
+	mover, isMoving := s.MovingEntity(c)
+
+	var resolved string
+	switch {
+	case !isMoving:
+		resolved = fmt.Sprintf("%d and %d", c.A.Id(), c.B.Id())
+	case mover == c.A:
+		resolved = fmt.Sprintf("%d into %d", c.A.Id(), c.B.Id())
+	default:
+		resolved = fmt.Sprintf("%d into %d", c.B.Id(), c.A.Id())
+	}
+
+	if inCycle {
+		resolved += "!"
+	}
+
+	s.resolved = append(s.resolved, resolved)
+}
+
+func DescribeCollisionSolver(c gospec.Context) {
+	e := make([]entitytest.MockEntity, 6)
+	for i := range e {
+		e[i] = entitytest.MockEntity{EntityId: entity.Id(i)}
+	}
+
+	newcg := func(collisions ...quad.Collision) quad.CollisionGroup {
+		var cg quad.CollisionGroup
+		for _, c := range collisions {
+			cg = cg.AddCollision(c)
+		}
+		return cg
+	}
+
+	solver := &mockCollisionSolver{
+		movingInto: make(map[entity.Id]entity.Id),
+	}
+
+	moving := func(a, b entitytest.MockEntity) quad.Collision {
+		solver.movingInto[a.Id()] = b.Id()
+		return quad.Collision{a, b}
+	}
+
+	c.Specify("a collision solver", func() {
+		c.Specify("will resolve a collision after the collisions it depends on", func() {
+			quad.SolveCollisionGroup(newcg(
+				moving(e[1], e[2]),
+				moving(e[2], e[3]),
+				moving(e[4], e[3]),
+				moving(e[3], e[5]),
+			), solver)
+
+			c.Expect(solver.resolved, ContainsInOrder, []string{
+				"3 into 5",
+				"2 into 3",
+				"1 into 2",
+				"4 into 3",
+			})
+		})
+
+		c.Specify("will resolve collisions that don't depend on each other in the group's order", func() {
+			quad.SolveCollisionGroup(newcg(
+				moving(e[1], e[2]),
+				moving(e[3], e[2]),
+				quad.Collision{e[1], e[3]},
+			), solver)
+
+			c.Expect(solver.resolved, ContainsInOrder, []string{
+				"1 into 2",
+				"3 into 2",
+				"1 and 3",
+			})
+		})
+
+		c.Specify("will resolve a collision without a moving entity before a collision that depends on it", func() {
+			quad.SolveCollisionGroup(newcg(
+				moving(e[1], e[2]),
+				quad.Collision{e[2], e[4]},
+			), solver)
+
+			c.Expect(solver.resolved, ContainsInOrder, []string{
+				"2 and 4",
+				"1 into 2",
+			})
+		})
+
+		c.Specify("will resolve a swap once", func() {
+			// 1 and 2 are moving into each other
+			solver.movingInto[e[2].Id()] = e[1].Id()
+
+			quad.SolveCollisionGroup(newcg(
+				moving(e[1], e[2]),
+			), solver)
+
+			c.Expect(solver.resolved, ContainsInOrder, []string{
+				"1 into 2",
+			})
+		})
+
+		c.Specify("will resolve the collision that closes a cycle first", func() {
+			quad.SolveCollisionGroup(newcg(
+				moving(e[1], e[2]),
+				moving(e[2], e[3]),
+				moving(e[3], e[4]),
+				moving(e[4], e[1]),
+			), solver)
+
+			c.Expect(solver.resolved, ContainsInOrder, []string{
+				"4 into 1!",
+				"3 into 4",
+				"2 into 3",
+				"1 into 2",
+			})
+
+			c.Specify("starting from the first collision of the cycle in the group", func() {
+				solver.resolved = nil
+
+				quad.SolveCollisionGroup(newcg(
+					moving(e[3], e[4]),
+					moving(e[1], e[2]),
+					moving(e[4], e[1]),
+					moving(e[2], e[3]),
+				), solver)
+
+				c.Expect(solver.resolved, ContainsInOrder, []string{
+					"2 into 3!",
+					"1 into 2",
+					"4 into 1",
+					"3 into 4",
+				})
+			})
+
+			c.Specify("before a collision that depends on the cycle", func() {
+				solver.resolved = nil
+
+				quad.SolveCollisionGroup(newcg(
+					moving(e[5], e[1]),
+					moving(e[1], e[2]),
+					moving(e[2], e[3]),
+					moving(e[3], e[1]),
+				), solver)
+
+				c.Expect(solver.resolved, ContainsInOrder, []string{
+					"3 into 1!",
+					"2 into 3",
+					"1 into 2",
+					"5 into 1",
+				})
+			})
+		})
+	})
+}
@@ -20,6 +20,7 @@ func TestUnitSpecs(t *testing.T) {
 	r.AddSpec(DescribeQuadInsert)
 
 	r.AddSpec(DescribePhase)
+	r.AddSpec(DescribeCollisionSolver)
 
 	gospec.MainGoTest(r, t)
 }
@@ -0,0 +1,189 @@
+package rpg2d
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ghthor/filu/rpg2d/coord"
+)
+
+var ErrSimulationAlreadyRegistered = errors.New("a simulation is already registered with that name")
+var ErrSimulationNotRegistered = errors.New("no simulation is registered with that name")
+
+// A RegistryError is returned when an operation on
+// a named simulation fails. The Err can be compared
+// with errors.Is or errors.As.
+type RegistryError struct {
+	Op   string
+	Name string
+	Err  error
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("%s simulation %q: %v", e.Op, e.Name, e.Err)
+}
+
+func (e *RegistryError) Unwrap() error { return e.Err }
+
+// A RollbackError is returned by a transfer that failed
+// and then failed to return the actor to the source
+// simulation. Err is the reason the transfer failed.
+type RollbackError struct {
+	Err         error
+	RollbackErr error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v, rollback failed: %v", e.Err, e.RollbackErr)
+}
+
+func (e *RollbackError) Unwrap() error { return e.Err }
+
+// An Actor that can be transferred between simulations.
+type TransferableActor interface {
+	Actor
+
+	// Returns the actor with its entity
+	// spawned at the cell in another world.
+	SpawnAt(coord.Cell) Actor
+}
+
+// A Registry manages multiple running simulations by name.
+// It is safe to use from multiple go routines.
+type Registry struct {
+	mu   sync.Mutex
+	sims map[string]RunningSimulation
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sims: make(map[string]RunningSimulation),
+	}
+}
+
+// Begin the simulation and register it with the name.
+func (r *Registry) Start(name string, def SimulationDef) (RunningSimulation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.sims[name]; exists {
+		return nil, &RegistryError{"start", name, ErrSimulationAlreadyRegistered}
+	}
+
+	rs, err := def.Begin()
+	if err != nil {
+		return nil, &RegistryError{"start", name, err}
+	}
+
+	r.sims[name] = rs
+	return rs, nil
+}
+
+// Returns the running simulation registered with the name.
+func (r *Registry) Lookup(name string) (RunningSimulation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rs, exists := r.sims[name]
+	return rs, exists
+}
+
+// Returns the names of all the registered simulations.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.sims))
+	for name := range r.sims {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Halt the simulation and remove it from the registry.
+func (r *Registry) Halt(name string) (HaltedSimulation, error) {
+	r.mu.Lock()
+	rs, exists := r.sims[name]
+	delete(r.sims, name)
+	r.mu.Unlock()
+
+	if !exists {
+		return nil, &RegistryError{"halt", name, ErrSimulationNotRegistered}
+	}
+
+	hs, err := rs.Halt()
+	if err != nil {
+		return nil, &RegistryError{"halt", name, err}
+	}
+
+	return hs, nil
+}
+
+// Halt every simulation and empty the registry. Every
+// simulation is halted even if halting one of them
+// fails, the first error that occurred is returned.
+func (r *Registry) HaltAll() (map[string]HaltedSimulation, error) {
+	r.mu.Lock()
+	sims := r.sims
+	r.sims = make(map[string]RunningSimulation)
+	r.mu.Unlock()
+
+	halted := make(map[string]HaltedSimulation, len(sims))
+
+	var firstErr error
+	for name, rs := range sims {
+		hs, err := rs.Halt()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = &RegistryError{"halt", name, err}
+			}
+			continue
+		}
+
+		halted[name] = hs
+	}
+
+	return halted, firstErr
+}
+
+// Transfer the actor from one running simulation into another
+// with its entity spawned at the cell. The entity is removed
+// from the source on its next tick and inserted into the target
+// on its next tick. The transfer is all or nothing, if the actor
+// can't be connected to the target it is returned to the source.
+// The context is only used while connecting to the target, once
+// the actor has been removed from the source the transfer will
+// either complete or be rolled back. Returns the actor that is
+// connected to the target simulation.
+func (r *Registry) Transfer(ctx context.Context, a TransferableActor, from, to string, spawn coord.Cell) (Actor, error) {
+	source, exists := r.Lookup(from)
+	if !exists {
+		return nil, &RegistryError{"transfer from", from, ErrSimulationNotRegistered}
+	}
+
+	target, exists := r.Lookup(to)
+	if !exists {
+		return nil, &RegistryError{"transfer to", to, ErrSimulationNotRegistered}
+	}
+
+	// The actor can't be in both simulations at once, and
+	// a removal that has been interrupted may or may not
+	// have happened, so it can't be cancelled.
+	if err := source.RemoveActorContext(context.Background(), a); err != nil {
+		return nil, &RegistryError{"transfer from", from, err}
+	}
+
+	spawned := a.SpawnAt(spawn)
+
+	if err := target.ConnectActorContext(ctx, spawned); err != nil {
+		// Rollback, the actor is returned to the source
+		if rerr := source.ConnectActorContext(context.Background(), a); rerr != nil {
+			err = &RollbackError{err, &RegistryError{"rollback transfer", from, rerr}}
+		}
+		return nil, &RegistryError{"transfer to", to, err}
+	}
+
+	return spawned, nil
+}
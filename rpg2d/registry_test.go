@@ -0,0 +1,202 @@
+package rpg2d_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d"
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+type transferActor struct {
+	mockActor
+}
+
+func (a transferActor) SpawnAt(cell coord.Cell) rpg2d.Actor {
+	a.cell = cell
+	return a
+}
+
+func DescribeRegistry(c gospec.Context) {
+	bounds := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	terrainMap, err := rpg2d.NewTerrainMap(bounds, string(rpg2d.TT_GRASS))
+	c.Assume(err, IsNil)
+
+	newDef := func(ticker rpg2d.TickSource) rpg2d.SimulationDef {
+		q, err := quad.New(bounds, 10, nil)
+		c.Assume(err, IsNil)
+
+		return rpg2d.SimulationDef{
+			FPS:        40,
+			TickSource: ticker,
+
+			QuadTree:   q,
+			TerrainMap: terrainMap,
+
+			UpdatePhaseHandler: mockUpdatePhase{},
+			InputPhaseHandler:  mockInputPhase{},
+			NarrowPhaseHandler: mockNarrowPhase{},
+		}
+	}
+
+	r := rpg2d.NewRegistry()
+
+	overworld := rpg2d.NewManualTicker(time.Time{})
+	dungeon := rpg2d.NewManualTicker(time.Time{})
+
+	_, err = r.Start("overworld", newDef(overworld))
+	c.Assume(err, IsNil)
+	_, err = r.Start("dungeon", newDef(dungeon))
+	c.Assume(err, IsNil)
+
+	defer r.HaltAll()
+
+	c.Specify("a registry", func() {
+		c.Specify("can look up a simulation by name", func() {
+			rs, exists := r.Lookup("overworld")
+			c.Expect(exists, IsTrue)
+			c.Expect(rs, Not(IsNil))
+
+			_, exists = r.Lookup("town")
+			c.Expect(exists, IsFalse)
+
+			c.Expect(r.Names(), ContainsExactly, []string{"overworld", "dungeon"})
+		})
+
+		c.Specify("will not start 2 simulations with the same name", func() {
+			_, err := r.Start("dungeon", newDef(rpg2d.NewManualTicker(time.Time{})))
+			c.Expect(errors.Is(err, rpg2d.ErrSimulationAlreadyRegistered), IsTrue)
+		})
+
+		c.Specify("can halt a simulation by name", func() {
+			_, err := r.Halt("dungeon")
+			c.Expect(err, IsNil)
+
+			_, exists := r.Lookup("dungeon")
+			c.Expect(exists, IsFalse)
+
+			_, err = r.Halt("dungeon")
+			c.Expect(errors.Is(err, rpg2d.ErrSimulationNotRegistered), IsTrue)
+		})
+
+		c.Specify("can halt every simulation", func() {
+			halted, err := r.HaltAll()
+			c.Expect(err, IsNil)
+			c.Expect(len(halted), Equals, 2)
+			c.Expect(len(r.Names()), Equals, 0)
+		})
+
+		c.Specify("can transfer an actor between simulations", func() {
+			a := transferActor{mockActor{
+				id:              1,
+				mockActorEntity: mockActorEntity{id: 1, cell: coord.Cell{1, 1}},
+			}}
+
+			source, _ := r.Lookup("overworld")
+			target, _ := r.Lookup("dungeon")
+
+			source.ConnectActor(a)
+			c.Assume(overworld.Step(1), Equals, 1)
+
+			c.Specify("and spawn it at a location", func() {
+				spawned, err := r.Transfer(context.Background(), a, "overworld", "dungeon", coord.Cell{-2, 3})
+				c.Assume(err, IsNil)
+				c.Expect(spawned.Entity().Cell(), Equals, coord.Cell{-2, 3})
+
+				c.Assume(overworld.Step(1), Equals, 1)
+				c.Assume(dungeon.Step(1), Equals, 1)
+
+				snapshot, err := source.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(len(snapshot.Actors), Equals, 0)
+
+				snapshot, err = target.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(snapshot.Actors, ContainsExactly, []rpg2d.ActorId{1})
+				c.Expect(snapshot.Time, Equals, stime.Time(1))
+				c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{spawned.Entity()})
+			})
+
+			c.Specify("and will leave it in the source if it can't be spawned", func() {
+				_, err := r.Transfer(context.Background(), a, "overworld", "dungeon", coord.Cell{100, 100})
+				c.Expect(errors.Is(err, rpg2d.ErrEntityOutOfBounds), IsTrue)
+
+				snapshot, err := source.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(snapshot.Actors, ContainsExactly, []rpg2d.ActorId{1})
+
+				snapshot, err = target.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(len(snapshot.Actors), Equals, 0)
+			})
+
+			c.Specify("and will leave it in the source if the context is done while connecting", func() {
+				slow := &slowActor{
+					recordingActor: recordingActor{mockActor: mockActor{
+						id:              3,
+						mockActorEntity: mockActorEntity{id: 3, cell: coord.Cell{5, 5}},
+					}},
+					writing: make(chan struct{}, 1),
+					release: make(chan struct{}),
+				}
+
+				target.ConnectActor(slow)
+
+				// The target is busy writing to the slow
+				// actor and can't connect the actor.
+				stepped := make(chan int)
+				go func() { stepped <- dungeon.Step(1) }()
+				<-slow.writing
+
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+
+				_, err := r.Transfer(ctx, a, "overworld", "dungeon", coord.Cell{0, 0})
+				c.Expect(errors.Is(err, context.DeadlineExceeded), IsTrue)
+
+				close(slow.release)
+				c.Assume(<-stepped, Equals, 1)
+				c.Assume(overworld.Step(1), Equals, 1)
+
+				snapshot, err := source.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(snapshot.Actors, ContainsExactly, []rpg2d.ActorId{1})
+				c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{a.Entity()})
+
+				snapshot, err = target.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(snapshot.Actors, ContainsExactly, []rpg2d.ActorId{3})
+			})
+
+			c.Specify("and will not transfer it if it isn't in the source", func() {
+				b := transferActor{mockActor{
+					id:              2,
+					mockActorEntity: mockActorEntity{id: 2},
+				}}
+
+				_, err := r.Transfer(context.Background(), b, "overworld", "dungeon", coord.Cell{0, 0})
+				c.Expect(errors.Is(err, rpg2d.ErrActorNotConnected), IsTrue)
+
+				snapshot, err := target.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(len(snapshot.Actors), Equals, 0)
+			})
+
+			c.Specify("and will not transfer to an unknown simulation", func() {
+				_, err := r.Transfer(context.Background(), a, "overworld", "town", coord.Cell{0, 0})
+				c.Expect(errors.Is(err, rpg2d.ErrSimulationNotRegistered), IsTrue)
+			})
+		})
+	})
+}
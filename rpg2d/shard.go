@@ -0,0 +1,593 @@
+package rpg2d
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// A ShardDef defines 1 of the simulations a large world is
+// split into. The shard owns the entities in its Region. Its
+// QuadTree must contain the Region and should also contain
+// the border around the Region, ghosts that are outside of
+// the QuadTree's bounds will not be mirrored into the shard.
+type ShardDef struct {
+	Name   string
+	Region coord.Bounds
+
+	SimulationDef
+}
+
+// A ShardGroupDef splits a world into adjacent shards.
+// Entities owned by a shard that are within Border cells
+// of another shard's region are mirrored into the other
+// shard as read-only ghosts. Entity ids must be unique
+// across all of the shards.
+type ShardGroupDef struct {
+	Border int
+	Shards []ShardDef
+}
+
+var ErrShardAlreadyDefined = errors.New("a shard is already defined with that name")
+var ErrShardRegionOutOfBounds = errors.New("shard's region must be contained by its quad tree")
+var ErrShardRegionsOverlap = errors.New("shard regions must not overlap")
+
+// A Ghost is a read-only copy of an entity owned by a neighboring
+// shard. Ghosts are skipped by the update and input phases and
+// are included in the collision groups of the broad phase. Any
+// changes the narrow phase makes to a ghost are discarded. Ghosts
+// are included in the states written to the actors, but aren't
+// owned by the shard and are excluded from its snapshots.
+type Ghost struct {
+	entity.Entity
+
+	// The name of the shard that owns the entity
+	Shard string
+}
+
+// A ShardGroup is a set of running simulations that each
+// own a region of a world. Entities that move out of a shard's
+// region migrate to the shard that owns the cell they are in,
+// with the actor they represent.
+//
+// The running shards calculate their ticks in lockstep. A shard
+// waits before each tick until every running shard has calculated
+// its previous tick, so the ghosts and migrants a shard receives
+// are always from the tick before. A shard that is paused or has
+// been halted isn't waited for, and a paused shard that is stepped
+// doesn't wait for the others. A running shard that isn't receiving
+// ticks from its TickSource will hold the other shards at the barrier.
+type ShardGroup struct {
+	border int
+
+	// Guards the ghosts and migrants of every shard, the
+	// shard each actor is owned by and the barrier the
+	// shards wait at.
+	mu      sync.Mutex
+	barrier *sync.Cond
+
+	// The number of shards that are running and
+	// the number that are waiting at the barrier
+	running int
+	waiting int
+
+	// The shard each connected actor is owned by. An actor
+	// that is migrating is owned by the shard it's moving to.
+	actors map[ActorId]*shard
+
+	// Incremented once every shard has finished a tick
+	tick uint64
+
+	// Set by Halt to release the shards from the barrier
+	halting bool
+
+	shards []*shard
+	byName map[string]*shard
+}
+
+type shard struct {
+	group  *ShardGroup
+	name   string
+	region coord.Bounds
+
+	sim RunningSimulation
+
+	// Set by the shard's game loop while the simulation is paused
+	// and once it has halted. The other shards don't wait for it.
+	paused bool
+	halted bool
+
+	// The ghosts published by each neighbor. The next
+	// ghosts are published during the current tick and
+	// replace the ghosts once every shard has finished it.
+	ghosts     map[string][]entity.Entity
+	nextGhosts map[string][]entity.Entity
+
+	// Entities waiting to be inserted on the next tick
+	migrants     []migrant
+	nextMigrants []migrant
+}
+
+// An entity moving between shards and the actor it represents
+type migrant struct {
+	entity entity.Entity
+	actor  Actor
+}
+
+// Validates the shard definitions and begins a simulation for every shard.
+func (def ShardGroupDef) Begin() (*ShardGroup, error) {
+	g := &ShardGroup{
+		border: def.Border,
+		byName: make(map[string]*shard, len(def.Shards)),
+		actors: make(map[ActorId]*shard),
+	}
+	g.barrier = sync.NewCond(&g.mu)
+
+	for i, sd := range def.Shards {
+		if _, exists := g.byName[sd.Name]; exists {
+			return nil, fmt.Errorf("shard %q: %w", sd.Name, ErrShardAlreadyDefined)
+		}
+
+		if sd.QuadTree == nil {
+			return nil, fmt.Errorf("shard %q: %w", sd.Name, ErrMustProvideAQuadtree)
+		}
+
+		if !containsBounds(sd.QuadTree.Bounds(), sd.Region) {
+			return nil, fmt.Errorf("shard %q: %w", sd.Name, ErrShardRegionOutOfBounds)
+		}
+
+		for _, other := range def.Shards[:i] {
+			if sd.Region.Overlaps(other.Region) {
+				return nil, fmt.Errorf("shard %q and %q: %w", sd.Name, other.Name, ErrShardRegionsOverlap)
+			}
+		}
+
+		s := &shard{
+			group:      g,
+			name:       sd.Name,
+			region:     sd.Region,
+			ghosts:     make(map[string][]entity.Entity),
+			nextGhosts: make(map[string][]entity.Entity),
+		}
+
+		g.shards = append(g.shards, s)
+		g.byName[s.name] = s
+	}
+
+	// Mirror the initial entities so the ghosts
+	// are received on the first tick.
+	for i, sd := range def.Shards {
+		s := g.shards[i]
+		for neighbor, ghosts := range s.mirror(sd.QuadTree.QueryBounds(sd.QuadTree.Bounds())) {
+			neighbor.nextGhosts[s.name] = ghosts
+		}
+	}
+
+	g.running = len(g.shards)
+
+	for i, sd := range def.Shards {
+		s := g.shards[i]
+
+		sd.SimulationDef.shard = s
+		rs, err := sd.SimulationDef.Begin()
+		if err != nil {
+			for _, started := range g.shards[:i] {
+				started.sim.Halt()
+			}
+
+			return nil, fmt.Errorf("shard %q: %w", sd.Name, err)
+		}
+
+		s.sim = rs
+	}
+
+	return g, nil
+}
+
+// Returns the running simulation of the shard.
+func (g *ShardGroup) Lookup(name string) (RunningSimulation, bool) {
+	s, exists := g.byName[name]
+	if !exists {
+		return nil, false
+	}
+	return s.sim, true
+}
+
+// Returns the name of the shard that owns the cell.
+func (g *ShardGroup) ShardAt(cell coord.Cell) (string, bool) {
+	if s := g.owner(cell); s != nil {
+		return s.name, true
+	}
+	return "", false
+}
+
+// Returns the name of the shard the actor is connected to.
+// An actor that is migrating is owned by the shard it's moving to.
+func (g *ShardGroup) ShardOf(id ActorId) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if s, exists := g.actors[id]; exists {
+		return s.name, true
+	}
+	return "", false
+}
+
+// Connect the actor to the shard that owns its entity's cell.
+func (g *ShardGroup) ConnectActor(a Actor) error {
+	s := g.owner(a.Entity().Cell())
+	if s == nil {
+		return &ActorError{"connect", a.Id(), ErrEntityOutOfBounds}
+	}
+
+	return s.sim.ConnectActorContext(context.Background(), a)
+}
+
+// Remove the actor from the shard it's connected to. An actor that
+// is migrating is removed, with its entity, before it's received
+// by the shard it's moving to.
+func (g *ShardGroup) RemoveActor(a Actor) error {
+	for {
+		g.mu.Lock()
+		s, exists := g.actors[a.Id()]
+		dropped := exists && s.dropMigrant(a.Id())
+		if dropped {
+			delete(g.actors, a.Id())
+		}
+		g.mu.Unlock()
+
+		switch {
+		case !exists:
+			return &ActorError{"remove", a.Id(), ErrActorNotConnected}
+		case dropped:
+			return nil
+		}
+
+		err := s.sim.RemoveActorContext(context.Background(), a)
+		if errors.Is(err, ErrActorNotConnected) && g.hasMigrated(a.Id(), s) {
+			// The actor left the shard before it could be removed
+			continue
+		}
+
+		return err
+	}
+}
+
+// Returns true if the actor is no longer owned by the shard.
+func (g *ShardGroup) hasMigrated(id ActorId, from *shard) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, exists := g.actors[id]
+	return exists && s != from
+}
+
+// Halt every shard. Every shard is halted even if halting
+// one of them fails, the first error that occurred is returned.
+func (g *ShardGroup) Halt() (map[string]HaltedSimulation, error) {
+	// The shards no longer wait for each other so
+	// they can halt in any order.
+	g.mu.Lock()
+	g.halting = true
+	g.barrier.Broadcast()
+	g.mu.Unlock()
+
+	halted := make(map[string]HaltedSimulation, len(g.shards))
+
+	var firstErr error
+	for _, s := range g.shards {
+		hs, err := s.sim.Halt()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("shard %q: %w", s.name, err)
+			}
+			continue
+		}
+
+		halted[s.name] = hs
+	}
+
+	return halted, firstErr
+}
+
+func (g *ShardGroup) owner(cell coord.Cell) *shard {
+	for _, s := range g.shards {
+		if s.region.Contains(cell) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Must be called with the mutex locked. Waits until every
+// running shard has finished its previous tick.
+func (g *ShardGroup) waitForShards() {
+	if g.halting {
+		return
+	}
+
+	tick := g.tick
+	g.waiting++
+
+	if g.waiting >= g.running {
+		g.nextTick()
+		return
+	}
+
+	for tick == g.tick && !g.halting {
+		g.barrier.Wait()
+	}
+}
+
+// Must be called with the mutex locked. Stops waiting for a shard
+// that has paused or halted and releases the shards at the barrier
+// if every running shard is now waiting.
+func (g *ShardGroup) release() {
+	g.running--
+	if g.waiting > 0 && g.waiting >= g.running {
+		g.nextTick()
+	}
+}
+
+// Must be called with the mutex locked. Replaces the ghosts and
+// migrants of every shard with the ones published during the
+// tick every shard has finished and releases the shards.
+func (g *ShardGroup) nextTick() {
+	for _, s := range g.shards {
+		// A paused neighbor doesn't publish its ghosts
+		// so the ghosts it last published are kept.
+		next := make(map[string][]entity.Entity, len(s.nextGhosts))
+		for name, ghosts := range s.nextGhosts {
+			next[name] = ghosts
+		}
+
+		s.ghosts, s.nextGhosts = s.nextGhosts, next
+		s.migrants, s.nextMigrants = append(s.migrants, s.nextMigrants...), nil
+	}
+
+	g.waiting = 0
+	g.tick++
+	g.barrier.Broadcast()
+}
+
+// Called by the shard's game loop before a tick is calculated.
+// Waits for the other shards and returns the entities that have
+// migrated into the shard and the ghosts that have been published
+// by its neighbors.
+func (s *shard) receive() (migrants []migrant, ghosts []entity.Entity) {
+	s.group.mu.Lock()
+	defer s.group.mu.Unlock()
+
+	// A paused shard is only calculating a tick when it's
+	// stepped, and doesn't wait for the other shards.
+	inLockstep := !s.paused && !s.group.halting
+	if inLockstep {
+		s.group.waitForShards()
+	}
+
+	migrants, s.migrants = s.migrants, nil
+
+	if !inLockstep {
+		migrants, s.nextMigrants = append(migrants, s.nextMigrants...), nil
+	}
+
+	for _, neighbor := range s.group.shards {
+		ghosts = append(ghosts, s.ghosts[neighbor.name]...)
+	}
+
+	return migrants, ghosts
+}
+
+// Called by the shard's game loop when the simulation
+// is paused so the other shards will no longer wait for it.
+func (s *shard) pause() {
+	g := s.group
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !s.paused && !s.halted {
+		s.paused = true
+		g.release()
+	}
+}
+
+// Called by the shard's game loop when the simulation is
+// resumed so the other shards will wait for it again.
+func (s *shard) resume() {
+	g := s.group
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if s.paused && !s.halted {
+		s.paused = false
+		g.running++
+	}
+}
+
+// Called by the shard's game loop once it has halted so
+// the other shards will no longer wait for it. Its actors
+// are no longer owned by the group and its ghosts are
+// removed from its neighbors on their next tick.
+func (s *shard) leave() {
+	g := s.group
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !s.paused {
+		g.release()
+	}
+	s.halted = true
+
+	for id, owner := range g.actors {
+		if owner == s {
+			delete(g.actors, id)
+		}
+	}
+
+	for _, neighbor := range g.shards {
+		delete(neighbor.nextGhosts, s.name)
+	}
+}
+
+// Called by the shard's game loop when an actor is connected to it.
+func (s *shard) track(id ActorId) {
+	s.group.mu.Lock()
+	defer s.group.mu.Unlock()
+
+	s.group.actors[id] = s
+}
+
+// Called by the shard's game loop when an actor is removed from it.
+// An actor that has migrated is owned by the shard it moved to.
+func (s *shard) untrack(id ActorId) {
+	s.group.mu.Lock()
+	defer s.group.mu.Unlock()
+
+	if s.group.actors[id] == s {
+		delete(s.group.actors, id)
+	}
+}
+
+// Must be called with the mutex locked. Removes the migrant of
+// the actor from the entities waiting to be received by the shard.
+func (s *shard) dropMigrant(id ActorId) bool {
+	for _, migrants := range []*[]migrant{&s.migrants, &s.nextMigrants} {
+		for i, m := range *migrants {
+			if m.actor != nil && m.actor.Id() == id {
+				*migrants = append((*migrants)[:i], (*migrants)[i+1:]...)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Called by the shard's game loop after a tick has been calculated.
+// Entities the shard owns that have moved into a neighbor's region
+// are sent to the neighbor and returned. The entities near a
+// neighbor's region are the ghosts the neighbor will receive on its
+// next tick. Ghosts aren't owned by the shard and are ignored.
+func (s *shard) publish(entities []entity.Entity, actorOf func(entity.Entity) Actor) (emigrants []entity.Entity) {
+	s.group.mu.Lock()
+	defer s.group.mu.Unlock()
+
+	var owned []entity.Entity
+	for _, e := range entities {
+		if _, isGhost := e.(Ghost); isGhost {
+			continue
+		}
+
+		if !s.region.Contains(e.Cell()) && e.Flags()&entity.FlagRemoved == 0 {
+			if owner := s.group.owner(e.Cell()); owner != nil && !owner.halted {
+				a := actorOf(e)
+				if a != nil {
+					s.group.actors[a.Id()] = owner
+				}
+
+				owner.nextMigrants = append(owner.nextMigrants, migrant{e, a})
+				emigrants = append(emigrants, e)
+				continue
+			}
+		}
+
+		owned = append(owned, e)
+	}
+
+	published := s.mirror(owned)
+	for _, neighbor := range s.group.shards {
+		if neighbor != s {
+			neighbor.nextGhosts[s.name] = published[neighbor]
+		}
+	}
+
+	return emigrants
+}
+
+// Returns the ghosts of the entities near each neighbor's region.
+func (s *shard) mirror(entities []entity.Entity) map[*shard][]entity.Entity {
+	published := make(map[*shard][]entity.Entity, len(s.group.shards))
+
+	for _, e := range entities {
+		if e.Flags()&entity.FlagRemoved != 0 {
+			continue
+		}
+
+		for _, neighbor := range s.group.shards {
+			if neighbor == s {
+				continue
+			}
+
+			if neighbor.region.Expand(s.group.border).Overlaps(e.Bounds()) {
+				published[neighbor] = append(published[neighbor], Ghost{e, s.name})
+			}
+		}
+	}
+
+	return published
+}
+
+// Wraps the phase handlers so ghosts are read-only.
+func ghostUpdatePhase(p quad.UpdatePhaseHandler) quad.UpdatePhaseHandler {
+	return quad.UpdatePhaseHandlerFn(func(e entity.Entity, now stime.Time) entity.Entity {
+		if _, isGhost := e.(Ghost); isGhost {
+			return e
+		}
+		return p.Update(e, now)
+	})
+}
+
+func ghostInputPhase(p quad.InputPhaseHandler) quad.InputPhaseHandler {
+	return quad.InputPhaseHandlerFn(func(e entity.Entity, now stime.Time) []entity.Entity {
+		if _, isGhost := e.(Ghost); isGhost {
+			return []entity.Entity{e}
+		}
+		return p.ApplyInputsTo(e, now)
+	})
+}
+
+// The ghosts map is updated by the game loop before each tick and
+// is only read during the narrow phase, so the handler is as
+// concurrency safe as the handler it wraps.
+type ghostNarrowPhase struct {
+	quad.NarrowPhaseHandler
+	ghosts map[entity.Id]bool
+}
+
+func (p ghostNarrowPhase) withoutGhosts(entities []entity.Entity) []entity.Entity {
+	var filtered []entity.Entity
+	for _, e := range entities {
+		if !p.ghosts[e.Id()] {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// The ghosts in the collision group are returned unchanged
+// so they remain in the world until the next tick.
+func (p ghostNarrowPhase) ResolveCollisions(cg *quad.CollisionGroup, now stime.Time) ([]entity.Entity, []entity.Entity) {
+	entities, removed := p.NarrowPhaseHandler.ResolveCollisions(cg, now)
+
+	entities = p.withoutGhosts(entities)
+	for _, e := range cg.Entities {
+		if p.ghosts[e.Id()] {
+			entities = append(entities, e)
+		}
+	}
+
+	return entities, p.withoutGhosts(removed)
+}
+
+func (p ghostNarrowPhase) ConcurrencySafe() bool {
+	return quad.IsConcurrencySafe(p.NarrowPhaseHandler)
+}
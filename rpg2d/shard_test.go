@@ -0,0 +1,365 @@
+package rpg2d_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d"
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+// An actor that records the entities of the last state written to it
+type viewingActor struct {
+	mockActor
+
+	mu       sync.Mutex
+	entities entity.StateSlice
+}
+
+func (a *viewingActor) WriteState(s rpg2d.WorldState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entities = append(a.entities[:0], s.Entities...)
+}
+
+func (a *viewingActor) view() entity.StateSlice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append(entity.StateSlice(nil), a.entities...)
+}
+
+func DescribeShardGroup(c gospec.Context) {
+	bounds := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	west := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{-1, -7},
+	}
+
+	east := coord.Bounds{
+		TopL: coord.Cell{0, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	terrainMap, err := rpg2d.NewTerrainMap(bounds, string(rpg2d.TT_GRASS))
+	c.Assume(err, IsNil)
+
+	newShard := func(name string, region coord.Bounds, ticker rpg2d.TickSource) rpg2d.ShardDef {
+		q, err := quad.New(bounds, 10, nil)
+		c.Assume(err, IsNil)
+
+		return rpg2d.ShardDef{
+			Name:   name,
+			Region: region,
+
+			SimulationDef: rpg2d.SimulationDef{
+				FPS:        40,
+				TickSource: ticker,
+
+				QuadTree:   q,
+				TerrainMap: terrainMap,
+
+				UpdatePhaseHandler: mockUpdatePhase{},
+				InputPhaseHandler:  mockInputPhase{},
+				NarrowPhaseHandler: mockNarrowPhase{},
+			},
+		}
+	}
+
+	c.Specify("a shard group", func() {
+		westTicker := rpg2d.NewManualTicker(time.Time{})
+		eastTicker := rpg2d.NewManualTicker(time.Time{})
+
+		def := rpg2d.ShardGroupDef{
+			Border: 1,
+			Shards: []rpg2d.ShardDef{
+				newShard("west", west, westTicker),
+				newShard("east", east, eastTicker),
+			},
+		}
+
+		// Steps both shards, which wait for each other
+		step := func(n int) {
+			var wg sync.WaitGroup
+			stepped := make([]int, 2)
+
+			for i, ticker := range []*rpg2d.ManualTicker{westTicker, eastTicker} {
+				wg.Add(1)
+				go func(i int, ticker *rpg2d.ManualTicker) {
+					defer wg.Done()
+					stepped[i] = ticker.Step(n)
+				}(i, ticker)
+			}
+
+			wg.Wait()
+			c.Assume(stepped, ContainsExactly, []int{n, n})
+		}
+
+		c.Specify("will not begin with overlapping regions", func() {
+			def.Shards[1].Region = bounds
+			_, err := def.Begin()
+			c.Expect(errors.Is(err, rpg2d.ErrShardRegionsOverlap), IsTrue)
+		})
+
+		c.Specify("will not begin with a region outside of a quad tree", func() {
+			def.Shards[1].Region = coord.Bounds{
+				TopL: coord.Cell{0, 8},
+				BotR: coord.Cell{15, -7},
+			}
+			_, err := def.Begin()
+			c.Expect(errors.Is(err, rpg2d.ErrShardRegionOutOfBounds), IsTrue)
+		})
+
+		c.Specify("will not begin with 2 shards with the same name", func() {
+			def.Shards[1].Name = "west"
+			_, err := def.Begin()
+			c.Expect(errors.Is(err, rpg2d.ErrShardAlreadyDefined), IsTrue)
+		})
+
+		c.Specify("will mirror entities near a border as ghosts", func() {
+			near := entitytest.MockEntityWithBounds{
+				EntityId:   1,
+				EntityCell: coord.Cell{-1, 0},
+				EntityBounds: coord.Bounds{
+					TopL: coord.Cell{-1, 0},
+					BotR: coord.Cell{0, 0},
+				},
+			}
+			far := entitytest.MockEntity{EntityId: 2, EntityCell: coord.Cell{-6, 0}}
+			other := entitytest.MockEntity{EntityId: 3, EntityCell: coord.Cell{0, 0}}
+
+			def.Shards[0].QuadTree = def.Shards[0].QuadTree.Insert(near).Insert(far)
+			def.Shards[1].QuadTree = def.Shards[1].QuadTree.Insert(other)
+
+			var groups [][]entity.Entity
+			def.Shards[1].NarrowPhaseHandler = quad.NarrowPhaseHandlerFn(
+				func(cg *quad.CollisionGroup, now stime.Time) ([]entity.Entity, []entity.Entity) {
+					groups = append(groups, cg.Entities)
+
+					// Attempt to modify the ghost
+					var entities []entity.Entity
+					for _, e := range cg.Entities {
+						if g, isGhost := e.(rpg2d.Ghost); isGhost {
+							e = entitytest.MockEntity{EntityId: g.Id(), EntityCell: coord.Cell{5, 5}}
+						}
+						entities = append(entities, e)
+					}
+					return entities, nil
+				})
+
+			g, err := def.Begin()
+			c.Assume(err, IsNil)
+			defer g.Halt()
+
+			a := &viewingActor{mockActor: mockActor{
+				id:              4,
+				mockActorEntity: mockActorEntity{id: 4, cell: coord.Cell{4, 4}},
+			}}
+			c.Assume(g.ConnectActor(a), IsNil)
+
+			step(1)
+
+			c.Assume(len(groups), Equals, 1)
+			c.Expect(groups[0], ContainsExactly, []entity.Entity{
+				rpg2d.Ghost{Entity: near, Shard: "west"},
+				other,
+			})
+
+			rs, _ := g.Lookup("east")
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{other, a.Entity()})
+
+			rs, _ = g.Lookup("west")
+			snapshot, err = rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{far, near})
+
+			c.Specify("and write the ghosts to the actors", func() {
+				c.Expect(a.view(), ContainsExactly, entity.StateSlice{
+					near.ToState(),
+					other.ToState(),
+					a.Entity().ToState(),
+				})
+			})
+		})
+
+		c.Specify("will calculate the ticks of every shard in lockstep", func() {
+			g, err := def.Begin()
+			c.Assume(err, IsNil)
+			defer g.Halt()
+
+			stepped := make(chan int)
+			go func() { stepped <- westTicker.Step(1) }()
+
+			select {
+			case <-stepped:
+				c.Expect("west to wait for east", Equals, "west stepped alone")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			c.Expect(eastTicker.Step(1), Equals, 1)
+			c.Expect(<-stepped, Equals, 1)
+		})
+
+		c.Specify("will not wait for a shard that is paused", func() {
+			g, err := def.Begin()
+			c.Assume(err, IsNil)
+			defer g.Halt()
+
+			rs, _ := g.Lookup("east")
+			c.Assume(rs.Pause(), IsNil)
+
+			stepped := make(chan int)
+			go func() { stepped <- westTicker.Step(1) }()
+
+			select {
+			case n := <-stepped:
+				c.Expect(n, Equals, 1)
+			case <-time.After(time.Second):
+				c.Expect("west to step alone", Equals, "west waited for east")
+			}
+
+			c.Specify("and can step the paused shard without waiting", func() {
+				done := make(chan error)
+				go func() { done <- rs.Step(1) }()
+
+				select {
+				case err := <-done:
+					c.Expect(err, IsNil)
+				case <-time.After(time.Second):
+					c.Expect("east to step alone", Equals, "east waited for west")
+				}
+			})
+
+			c.Specify("and will wait for the shard once it's resumed", func() {
+				c.Assume(rs.Resume(), IsNil)
+
+				go func() { stepped <- westTicker.Step(1) }()
+
+				select {
+				case <-stepped:
+					c.Expect("west to wait for east", Equals, "west stepped alone")
+				case <-time.After(20 * time.Millisecond):
+				}
+
+				c.Expect(eastTicker.Step(1), Equals, 1)
+				c.Expect(<-stepped, Equals, 1)
+			})
+		})
+
+		c.Specify("will not wait for a shard that has halted", func() {
+			g, err := def.Begin()
+			c.Assume(err, IsNil)
+			defer g.Halt()
+
+			rs, _ := g.Lookup("east")
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+
+			stepped := make(chan int)
+			go func() { stepped <- westTicker.Step(1) }()
+
+			select {
+			case n := <-stepped:
+				c.Expect(n, Equals, 1)
+			case <-time.After(time.Second):
+				c.Expect("west to step alone", Equals, "west waited for east")
+			}
+		})
+
+		c.Specify("will migrate an actor across a border", func() {
+			def.Shards[0].UpdatePhaseHandler = quad.UpdatePhaseHandlerFn(
+				func(e entity.Entity, now stime.Time) entity.Entity {
+					if e, isActor := e.(mockActorEntity); isActor {
+						e.cell.X++
+						return e
+					}
+					return e
+				})
+
+			g, err := def.Begin()
+			c.Assume(err, IsNil)
+			defer g.Halt()
+
+			a := &recordingActor{mockActor: mockActor{
+				id:              1,
+				mockActorEntity: mockActorEntity{id: 1, cell: coord.Cell{-1, 2}},
+			}}
+
+			c.Assume(g.ConnectActor(a), IsNil)
+
+			name, _ := g.ShardAt(coord.Cell{-1, 2})
+			c.Expect(name, Equals, "west")
+
+			name, _ = g.ShardOf(a.Id())
+			c.Expect(name, Equals, "west")
+
+			step(1)
+
+			rs, _ := g.Lookup("west")
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(len(snapshot.Actors), Equals, 0)
+			c.Expect(len(snapshot.Entities), Equals, 0)
+
+			// The actor is owned by east while it's migrating
+			name, _ = g.ShardOf(a.Id())
+			c.Expect(name, Equals, "east")
+
+			c.Specify("and can remove the actor while it's migrating", func() {
+				c.Assume(g.RemoveActor(a), IsNil)
+
+				_, exists := g.ShardOf(a.Id())
+				c.Expect(exists, IsFalse)
+
+				step(1)
+
+				rs, _ = g.Lookup("east")
+				snapshot, err = rs.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(len(snapshot.Actors), Equals, 0)
+				c.Expect(len(snapshot.Entities), Equals, 0)
+			})
+
+			c.Specify("and the shard it migrated to will receive it on the next tick", func() {
+				step(1)
+
+				rs, _ = g.Lookup("east")
+				snapshot, err = rs.Snapshot()
+				c.Assume(err, IsNil)
+				c.Expect(snapshot.Actors, ContainsExactly, []rpg2d.ActorId{1})
+				c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{
+					mockActorEntity{id: 1, cell: coord.Cell{0, 2}},
+				})
+
+				c.Expect(a.times(), ContainsExactly, []stime.Time{2})
+
+				c.Specify("and can remove the actor once it has migrated", func() {
+					c.Assume(g.RemoveActor(a), IsNil)
+
+					_, exists := g.ShardOf(a.Id())
+					c.Expect(exists, IsFalse)
+
+					snapshot, err = rs.Snapshot()
+					c.Assume(err, IsNil)
+					c.Expect(len(snapshot.Actors), Equals, 0)
+
+					err = g.RemoveActor(a)
+					c.Expect(errors.Is(err, rpg2d.ErrActorNotConnected), IsTrue)
+				})
+			})
+		})
+	})
+}
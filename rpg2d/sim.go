@@ -1,10 +1,13 @@
 package rpg2d
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/ghthor/filu/rpg2d/coord"
 	"github.com/ghthor/filu/rpg2d/entity"
 	"github.com/ghthor/filu/rpg2d/quad"
 	"github.com/ghthor/filu/sim/stime"
@@ -30,33 +33,141 @@ type SimulationDef struct {
 	// The target FPS for the simulation to calculate at
 	FPS int
 
+	// Decides when the simulation will calculate a tick.
+	// Defaults to RealTime if nil.
+	TickSource TickSource
+
+	// Decides how the simulation will keep its clock
+	// consistent with wall time when calculating a tick
+	// takes longer than a frame. Defaults to OverrunSlowClock.
+	OverrunPolicy OverrunPolicy
+
+	// The maximum number of ticks that will be calculated
+	// when catching up with OverrunCatchUp. Defaults to 5.
+	MaxCatchUpTicks int
+
+	// Notified with the measurements of every tick. Optional.
+	Observer TickObserver
+
+	// The maximum amount of time the simulation will wait
+	// for the state of a tick to be written to all the actors.
+	// An actor that is still writing the state of a previous
+	// tick isn't waited for. Defaults to 1 second, a negative
+	// deadline will wait for every actor.
+	WriteStateDeadline time.Duration
+
+	// The number of states that can be waiting to be written
+	// to an actor before the SlowActorPolicy is applied.
+	// Defaults to 1.
+	ActorQueueSize int
+
+	// Decides what happens to an actor when it's queue
+	// is full. Defaults to SlowActorSkip.
+	SlowActorPolicy SlowActorPolicy
+
+	// When > 0 the simulation will cull the state written to
+	// each actor to the cells within ViewRadius of the actor's
+	// entity. An actor receives an initial culled state and
+	// then a WorldStateDiff every tick if it implements
+	// StateDiffWriter, otherwise a culled state every tick.
+	ViewRadius int
+
+	// When > 0 halting the simulation will write a final state
+	// to every actor, notify the actors that implement
+	// HaltListener and wait up to DrainPeriod for them to finish.
+	DrainPeriod time.Duration
+
+	// Called in order by the simulation's go routine once it
+	// has halted, before Halt returns. Optional.
+	OnHalt []func(HaltedSimulation)
+
+	// Called by the simulation when an actor has been
+	// disconnected by SlowActorDisconnect. Optional. It is
+	// called from the simulation's go routine and must not
+	// call any methods of the simulation.
+	OnActorDropped func(ActorDropped)
+
 	// Initial World State
 	Now        stime.Time
 	QuadTree   quad.Quad
 	TerrainMap TerrainMap
 
+	// Timers that are pending when the simulation begins. A
+	// timer without an id is assigned one and a timer at or
+	// before Now will fire on the first tick.
+	Timers []Timer
+
+	// User defined handlers of timers, by name
+	TimerHandlers map[string]TimerHandler
+
 	// User defined update phase handler
 	quad.UpdatePhaseHandler
 
 	// User defined input application phase
 	InputPhaseHandler quad.InputPhaseHandler
 
+	// User defined input application phase that is handed
+	// the commands drained from the InputQueue. Can be used
+	// instead of an InputPhaseHandler.
+	CommandPhaseHandler CommandPhaseHandler
+	InputQueue          *InputQueue
+
 	// User defined the narrow phase
 	NarrowPhaseHandler quad.NarrowPhaseHandler
+
+	// Calculate the broad phase of the quad tree's children
+	// concurrently. The collision groups are identical to the
+	// serial broad phase. Useful for worlds with many entities.
+	ParallelBroadPhase bool
+
+	// When > 1 the collision groups are resolved by a pool of
+	// NarrowPhaseWorkers go routines. The NarrowPhaseHandler
+	// must implement quad.ConcurrentNarrowPhaseHandler. The
+	// results are applied in the same order as the serial
+	// narrow phase. Defaults to 0, which is serial.
+	NarrowPhaseWorkers int
+
+	// Set by a ShardGroup to connect the
+	// simulation to its neighboring shards
+	shard *shard
 }
 
 type initialWorldState struct {
 	now        stime.Time
 	quadTree   quad.Quad
 	terrainMap TerrainMap
+	timers     []Timer
 }
 
 type simSettings struct {
-	fps int
+	fps        int
+	tickSource TickSource
+
+	overrunPolicy   OverrunPolicy
+	maxCatchUpTicks int
+
+	observer TickObserver
+
+	writeStateDeadline time.Duration
+	actorQueueSize     int
+	slowActorPolicy    SlowActorPolicy
+	onActorDropped     func(ActorDropped)
+	viewRadius         int
+	drainPeriod        time.Duration
+	onHalt             []func(HaltedSimulation)
 
 	quad.UpdatePhaseHandler
 	quad.InputPhaseHandler
 	quad.NarrowPhaseHandler
+
+	commandPhase CommandPhaseHandler
+	inputQueue   *InputQueue
+
+	timerHandlers map[string]TimerHandler
+
+	phaseOptions quad.PhaseOptions
+
+	shard *shard
 }
 
 type UnstartedSimulation interface {
@@ -66,11 +177,57 @@ type UnstartedSimulation interface {
 type RunningSimulation interface {
 	ConnectActor(Actor)
 	RemoveActor(Actor)
+
+	// Variants that will return an *ActorError if the actor
+	// couldn't be connected or removed, or the context is done
+	// before the simulation has received the request.
+	ConnectActorContext(context.Context, Actor) error
+	RemoveActorContext(context.Context, Actor) error
 	Halt() (HaltedSimulation, error)
+
+	// Returns the measurements of the
+	// ticks that have been calculated.
+	TickStats() TickStats
+
+	// Returns a snapshot of the world taken
+	// in between the calculation of ticks.
+	Snapshot() (WorldSnapshot, error)
+
+	// Controls the clock of the simulation.
+	Pause() error
+	Resume() error
+	Step(ticks int) error
+	SetFPS(fps int) error
+
+	// Schedule a timer that will fire the named handler at
+	// the start of the tick at, before the update phase.
+	Schedule(at stime.Time, handler string, data interface{}) (TimerId, error)
+	CancelTimer(TimerId) error
 }
 
 type HaltedSimulation interface {
 	Quad() quad.Quad
+
+	// Returns a snapshot of the world
+	// when the simulation was halted.
+	Snapshot() (WorldSnapshot, error)
+
+	// Returns statistics about the
+	// lifetime of the simulation.
+	Stats() SimulationStats
+}
+
+// SimulationStats are statistics about the lifetime of a simulation.
+type SimulationStats struct {
+	Ticks uint64
+
+	// Number of unique actors that were connected
+	ActorsSeen int
+
+	// The largest number of entities in the world after a tick
+	PeakEntities int
+
+	AverageTickTime time.Duration
 }
 
 // An implementation of RunningSimulation
@@ -78,12 +235,13 @@ type runningSimulation struct {
 	//---- Communication
 	// These channels are used by the public api
 	// to add and remove actors. They are 1way
-	// send only channels. The requests contains
-	// a send only and recieve only channel so the
-	// the public api call will be atomic action
-	// and the caller can assume without a doubt
-	// that the actor is now added or removed
-	// from the simulation.
+	// send only channels. The requests contain
+	// a buffered channel the game loop will send
+	// the result of the request on, so the public
+	// api call will be an atomic action and the
+	// caller can assume without a doubt that the
+	// actor is now added or removed from the
+	// simulation when no error is returned.
 	addActor    chan<- addActorReq
 	removeActor chan<- removeActorReq
 
@@ -93,66 +251,282 @@ type runningSimulation struct {
 	// api can wait and be notified that the go routine
 	// has returned and is no longer running.
 	requestHalt chan<- chan<- HaltedSimulation
+
+	// This channel is used by the public api to request
+	// a snapshot of the world in between ticks.
+	requestSnapshot chan<- chan<- snapshotResult
+
+	// This channel is used by the public api to pause,
+	// resume, step or change the fps of the simulation.
+	control chan<- controlRequest
+
+	// This channel is used by the public api
+	// to schedule and cancel timers.
+	timer chan<- timerRequest
+
+	// Closed by the game loop once it has halted. Used
+	// by the public api to release any blocked callers.
+	halted *haltedLoop
+
+	// Written by the game loop after every tick
+	stats *tickStats
+}
+
+type haltedLoop struct {
+	done chan struct{}
+
+	// Set before done is closed
+	sim HaltedSimulation
+}
+
+var ErrSimulationHalted = errors.New("simulation has been halted")
+var ErrActorAlreadyConnected = errors.New("actor is already connected to the simulation")
+var ErrActorNotConnected = errors.New("actor isn't connected to the simulation")
+var ErrEntityOutOfBounds = errors.New("actor's entity is outside the bounds of the simulation")
+
+// An ActorError is returned when connecting or removing
+// an actor fails. The Err can be compared with errors.Is.
+type ActorError struct {
+	Op    string
+	Actor ActorId
+	Err   error
+}
+
+func (e *ActorError) Error() string {
+	return fmt.Sprintf("%s actor %d: %v", e.Op, e.Actor, e.Err)
 }
 
+func (e *ActorError) Unwrap() error { return e.Err }
+
 // Communication object used to atomicly add a new actor to the sim
 type addActorReq struct {
-	toBeAdded chan Actor
-	wasAdded  chan Actor
+	actor  Actor
+	result chan error
 }
 
 // Add an actor into the running simulation
 func (s runningSimulation) ConnectActor(a Actor) {
-	ch := make(chan Actor)
+	s.ConnectActorContext(context.Background(), a)
+}
 
-	// Create an add request
-	actor := addActorReq{ch, ch}
+// Add an actor into the running simulation. If the context is
+// done after the request has been received by the simulation
+// the actor may still be connected.
+func (s runningSimulation) ConnectActorContext(ctx context.Context, a Actor) error {
+	req := addActorReq{a, make(chan error, 1)}
 
 	// Send the add request to the game loop
-	s.addActor <- actor
-
-	// Send the actor to be added to the game loop
-	actor.toBeAdded <- a
+	select {
+	case s.addActor <- req:
+	case <-ctx.Done():
+		return &ActorError{"connect", a.Id(), ctx.Err()}
+	case <-s.halted.done:
+		return &ActorError{"connect", a.Id(), ErrSimulationHalted}
+	}
 
-	// Wait for the add request to be successfully completed
-	a = <-actor.wasAdded
+	// Wait for the add request to be completed
+	return s.waitForActor(ctx, "connect", a, req.result)
 }
 
 // Communication object used to atomicly remove an actor from the sim
 type removeActorReq struct {
-	toBeRemoved chan Actor
-	wasRemoved  chan Actor
+	actor  Actor
+	result chan error
 }
 
 // Remove an actor from the running simulation
 func (s runningSimulation) RemoveActor(a Actor) {
-	ch := make(chan Actor)
+	s.RemoveActorContext(context.Background(), a)
+}
 
-	// Create a remove request
-	actor := removeActorReq{ch, ch}
+// Remove an actor from the running simulation. If the context
+// is done after the request has been received by the simulation
+// the actor may still be removed.
+func (s runningSimulation) RemoveActorContext(ctx context.Context, a Actor) error {
+	req := removeActorReq{a, make(chan error, 1)}
 
 	// Send the remove request to the game loop
-	s.removeActor <- actor
+	select {
+	case s.removeActor <- req:
+	case <-ctx.Done():
+		return &ActorError{"remove", a.Id(), ctx.Err()}
+	case <-s.halted.done:
+		return &ActorError{"remove", a.Id(), ErrSimulationHalted}
+	}
+
+	// Wait for the remove request to be completed
+	return s.waitForActor(ctx, "remove", a, req.result)
+}
+
+func (s runningSimulation) waitForActor(ctx context.Context, op string, a Actor, result <-chan error) error {
+	var err error
+
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.halted.done:
+		// The game loop always completes a request
+		// it has received before halting.
+		err = <-result
+	}
+
+	if err != nil {
+		return &ActorError{op, a.Id(), err}
+	}
+	return nil
+}
+
+type snapshotResult struct {
+	snapshot WorldSnapshot
+	err      error
+}
+
+type controlOp int
+
+const (
+	controlPause controlOp = iota
+	controlResume
+	controlStep
+	controlSetFPS
+)
+
+// Communication object used to control the game loop
+type controlRequest struct {
+	op   controlOp
+	n    int
+	done chan error
+}
+
+var ErrSimulationNotPaused = errors.New("simulation must be paused to step")
+var ErrInvalidFPS = errors.New("fps must be > 0")
+var ErrInvalidStep = errors.New("number of ticks to step must be > 0")
+
+// Communication object used to schedule or cancel a timer
+type timerRequest struct {
+	timer  Timer
+	cancel bool
+	result chan timerResult
+}
 
-	// Send the actor to be removed to the game loop
-	actor.toBeRemoved <- a
+type timerResult struct {
+	id  TimerId
+	err error
+}
+
+func (s runningSimulation) sendTimer(t Timer, cancel bool) (TimerId, error) {
+	req := timerRequest{t, cancel, make(chan timerResult, 1)}
+
+	// Send the request to the game loop
+	select {
+	case s.timer <- req:
+	case <-s.halted.done:
+		return 0, ErrSimulationHalted
+	}
+
+	result := <-req.result
+	return result.id, result.err
+}
+
+// Schedule a timer. The handler must be one of the
+// definition's TimerHandlers. A timer scheduled for a
+// tick that has already been calculated fires on the next tick.
+func (s runningSimulation) Schedule(at stime.Time, handler string, data interface{}) (TimerId, error) {
+	return s.sendTimer(Timer{At: at, Handler: handler, Data: data}, false)
+}
 
-	// Wait for the remove request to be successfully completed
-	a = <-actor.wasRemoved
+// Cancel a timer that hasn't fired yet.
+func (s runningSimulation) CancelTimer(id TimerId) error {
+	_, err := s.sendTimer(Timer{Id: id}, true)
+	return err
+}
+
+func (s runningSimulation) sendControl(op controlOp, n int) error {
+	req := controlRequest{op, n, make(chan error, 1)}
+
+	// Send the request to the game loop
+	select {
+	case s.control <- req:
+	case <-s.halted.done:
+		return ErrSimulationHalted
+	}
+
+	// Wait for the request to be completed
+	return <-req.done
+}
+
+// Stop calculating ticks until Resume is called.
+// Actors can still be connected and removed.
+func (s runningSimulation) Pause() error {
+	return s.sendControl(controlPause, 0)
+}
+
+// Continue calculating ticks after being paused.
+func (s runningSimulation) Resume() error {
+	return s.sendControl(controlResume, 0)
+}
+
+// Calculate n ticks while the simulation is paused. Each tick
+// waits for its state to be written to the actors the same
+// as a tick delivered by the TickSource, so Step can return
+// before a slow actor has been written every state if the
+// WriteStateDeadline has passed. Use a negative
+// WriteStateDeadline to have Step wait for every actor.
+func (s runningSimulation) Step(n int) error {
+	if n <= 0 {
+		return ErrInvalidStep
+	}
+	return s.sendControl(controlStep, n)
+}
+
+// Change the rate the simulation will calculate ticks at.
+func (s runningSimulation) SetFPS(fps int) error {
+	if fps <= 0 {
+		return ErrInvalidFPS
+	}
+	return s.sendControl(controlSetFPS, fps)
+}
+
+// Take a snapshot of the world
+func (s runningSimulation) Snapshot() (WorldSnapshot, error) {
+	ch := make(chan snapshotResult, 1)
+
+	// Send a request to the game loop for a snapshot
+	select {
+	case s.requestSnapshot <- ch:
+	case <-s.halted.done:
+		return s.halted.sim.Snapshot()
+	}
+
+	// Wait for the snapshot to be taken
+	result := <-ch
+	return result.snapshot, result.err
 }
 
 // Stop the simulation
 func (s runningSimulation) Halt() (HaltedSimulation, error) {
-	wasHalted := make(chan HaltedSimulation)
+	wasHalted := make(chan HaltedSimulation, 1)
 
 	// Send a request to the game loop to halt
-	s.requestHalt <- wasHalted
+	select {
+	case s.requestHalt <- wasHalted:
+	case <-s.halted.done:
+		// Enables Halt() method to be called an infinite number
+		// of times after the simulation has actually halted.
+		return s.halted.sim, nil
+	}
 
 	// Wait for the halt request to be successfully completed
 	return <-wasHalted, nil
 }
 
+// Return the measurements of the ticks that have been calculated
+func (s runningSimulation) TickStats() TickStats {
+	return s.stats.snapshot()
+}
+
 var ErrMustProvideAQuadtree = errors.New("user must provide a quad tree to a simulation defination")
+var ErrNarrowPhaseNotConcurrencySafe = errors.New("narrow phase handler must be concurrency safe to use narrow phase workers")
 var ErrMustProvideATerrainMap = errors.New("user must provide a terrain map to a simulation defination")
 
 // Implement engine/sim.UnstartedSimulation
@@ -165,21 +539,87 @@ func (s SimulationDef) Begin() (RunningSimulation, error) {
 		return nil, ErrMustProvideATerrainMap
 	}
 
+	if s.CommandPhaseHandler != nil {
+		if s.InputPhaseHandler != nil {
+			return nil, ErrInputPhaseConflict
+		}
+
+		if s.InputQueue == nil {
+			return nil, ErrMustProvideAnInputQueue
+		}
+	}
+
+	if s.NarrowPhaseWorkers > 1 && !quad.IsConcurrencySafe(s.NarrowPhaseHandler) {
+		return nil, ErrNarrowPhaseNotConcurrencySafe
+	}
+
+	timerIds := make(map[TimerId]bool, len(s.Timers))
+	for _, t := range s.Timers {
+		if _, exists := s.TimerHandlers[t.Handler]; !exists {
+			return nil, fmt.Errorf("timer %d %q: %w", t.Id, t.Handler, ErrUnknownTimerHandler)
+		}
+
+		if t.Id != 0 && timerIds[t.Id] {
+			return nil, fmt.Errorf("timer %d %q: %w", t.Id, t.Handler, ErrDuplicateTimerId)
+		}
+		timerIds[t.Id] = true
+	}
+
 	initialState := initialWorldState{
 		now:        s.Now,
 		quadTree:   s.QuadTree,
 		terrainMap: s.TerrainMap,
+		timers:     s.Timers,
+	}
+
+	tickSource := s.TickSource
+	if tickSource == nil {
+		tickSource = RealTime{}
+	}
+
+	writeStateDeadline := s.WriteStateDeadline
+	if writeStateDeadline == 0 {
+		writeStateDeadline = defaultWriteStateDeadline
 	}
 
 	settings := simSettings{
 		s.FPS,
+		tickSource,
+
+		s.OverrunPolicy,
+		s.MaxCatchUpTicks,
+
+		s.Observer,
+
+		writeStateDeadline,
+		s.ActorQueueSize,
+		s.SlowActorPolicy,
+		s.OnActorDropped,
+		s.ViewRadius,
+		s.DrainPeriod,
+		s.OnHalt,
 
 		s.UpdatePhaseHandler,
 		s.InputPhaseHandler,
 		s.NarrowPhaseHandler,
+
+		s.CommandPhaseHandler,
+		s.InputQueue,
+
+		s.TimerHandlers,
+
+		quad.PhaseOptions{
+			ParallelBroadPhase: s.ParallelBroadPhase,
+			NarrowPhaseWorkers: s.NarrowPhaseWorkers,
+		},
+
+		s.shard,
 	}
 
-	rs := &runningSimulation{}
+	rs := &runningSimulation{
+		halted: &haltedLoop{done: make(chan struct{})},
+		stats:  &tickStats{},
+	}
 
 	// Starts 2 go routines and returns
 	// The ticker and the engine communication kernel
@@ -217,6 +657,15 @@ func (s *runningSimulation) startLoop(initialState initialWorldState, settings s
 	// Map of all the actors currently connected to the simulation
 	actors := make(map[ActorId]Actor)
 
+	// Map of the go routines writing state to each actor
+	writers := make(map[ActorId]*actorWriter)
+
+	// Set of every actor that has been connected
+	actorsSeen := make(map[ActorId]struct{})
+
+	// The largest number of entities in the world after a tick
+	var peakEntities int
+
 	// Make channel to be used to by the public api to
 	// request that the simulation be halted
 	haltCh := make(chan chan<- HaltedSimulation)
@@ -228,8 +677,51 @@ func (s *runningSimulation) startLoop(initialState initialWorldState, settings s
 	var haltReq <-chan chan<- HaltedSimulation
 	haltReq = haltCh
 
+	// Make channel to be used by the public api to
+	// request a snapshot of the world
+	snapshotCh := make(chan chan<- snapshotResult)
+
+	// Set the 1way send channel used by the public api
+	s.requestSnapshot = snapshotCh
+
+	// Set the 1way recieve channel used by the game loop
+	var snapshotReq <-chan chan<- snapshotResult
+	snapshotReq = snapshotCh
+
+	// Make channel to be used by the public api to pause,
+	// resume, step or change the fps of the simulation
+	controlCh := make(chan controlRequest)
+
+	// Set the 1way send channel used by the public api
+	s.control = controlCh
+
+	// Set the 1way recieve channel used by the game loop
+	var controlReq <-chan controlRequest
+	controlReq = controlCh
+
+	// Make channel to be used by the public api
+	// to schedule and cancel timers
+	timerCh := make(chan timerRequest)
+
+	// Set the 1way send channel used by the public api
+	s.timer = timerCh
+
+	// Set the 1way recieve channel used by the game loop
+	var timerReq <-chan timerRequest
+	timerReq = timerCh
+
+	// Returns the ids of all the connected actors
+	actorIds := func() []ActorId {
+		ids := make([]ActorId, 0, len(actors))
+		for id := range actors {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
 	clock := stime.Clock(initialState.now)
 	world := NewWorld(initialState.now, initialState.quadTree, initialState.terrainMap)
+	world.timers.addAll(initialState.now, initialState.timers)
 
 	//---- User provided update phase
 	updatePhase := settings.UpdatePhaseHandler
@@ -237,29 +729,252 @@ func (s *runningSimulation) startLoop(initialState initialWorldState, settings s
 	//---- User provided input application phase
 	inputPhase := settings.InputPhaseHandler
 
+	// Map of the entities that represent the connected actors
+	entityActors := make(map[entity.Id]ActorId)
+
+	if settings.commandPhase != nil {
+		inputPhase = commandInputPhase(settings.inputQueue, settings.commandPhase, entityActors)
+	}
+
 	//---- User provided narrow phase
 	narrowPhase := settings.NarrowPhaseHandler
 
+	//---- User provided observer
+	observer := settings.observer
+
+	var phaseObserver quad.PhaseObserver
+	if observer != nil {
+		phaseObserver = observer
+	}
+
+	// The ids of the ghosts mirrored into the world for the current tick
+	ghostIds := make(map[entity.Id]bool)
+
+	if settings.shard != nil {
+		updatePhase = ghostUpdatePhase(updatePhase)
+		inputPhase = ghostInputPhase(inputPhase)
+		narrowPhase = ghostNarrowPhase{narrowPhase, ghostIds}
+	}
+
 	runTick := func(q quad.Quad, t stime.Time) quad.Quad {
-		return quad.RunPhasesOn(q, updatePhase, inputPhase, narrowPhase, t)
+		return quad.RunPhasesWithOptionsOn(q, updatePhase, inputPhase, narrowPhase, t, phaseObserver, settings.phaseOptions)
 	}
 
 	// Start the Clock
-	ticker := time.NewTicker(time.Duration(1000/settings.fps) * time.Millisecond)
+	period := tickPeriod(settings.fps)
+	ticker := settings.tickSource.Start(settings.fps)
+	pacer := newTickPacer(settings.overrunPolicy, settings.maxCatchUpTicks, period)
+	stats := s.stats
+	haltedLoop := s.halted
 
 	// Start the simulation server
 	go func() {
 		var hasHalted chan<- HaltedSimulation
 
-		var multiWrite sync.WaitGroup
+		// The time the ticker delivered the tick being calculated
+		var tickAt time.Time
+
+		// The frames that will be skipped and the number of
+		// ticks that will be calculated to keep the clock
+		// consistent with the time the tick was delivered at
+		var skipped int64
+		var ticks int
+
+		// Ticks from the ticker are ignored while paused
+		var paused bool
+		var tickC <-chan time.Time
+
+		// Start writing state to the actor
+		registerActor := func(a Actor, e entity.Entity) {
+			actors[a.Id()] = a
+			entityActors[e.Id()] = a.Id()
+			writers[a.Id()] = newActorWriter(a, settings.actorQueueSize, newActorView(settings.viewRadius))
+			actorsSeen[a.Id()] = struct{}{}
+
+			if settings.shard != nil {
+				settings.shard.track(a.Id())
+			}
+		}
+
+		// Stop writing state to the actor
+		unregisterActor := func(a Actor) {
+			delete(actors, a.Id())
+			delete(entityActors, a.Entity().Id())
+
+			writers[a.Id()].close()
+			delete(writers, a.Id())
+
+			if settings.shard != nil {
+				settings.shard.untrack(a.Id())
+			}
+		}
+
+		// Remove the actor's entity from the world on the
+		// next tick and stop writing state to the actor
+		removeActor := func(a Actor) {
+			world.Insert(entity.Removed{
+				Entity:    a.Entity(),
+				RemovedAt: clock.NextTick()})
+			unregisterActor(a)
+
+			if settings.inputQueue != nil {
+				settings.inputQueue.Forget(a.Id())
+			}
+		}
+
+		// Remove the ghosts mirrored into the world for the previous tick
+		removeGhosts := func() {
+			for _, g := range world.quadTree.QueryBounds(world.quadTree.Bounds()) {
+				if ghostIds[g.Id()] {
+					world.Remove(g)
+					delete(ghostIds, g.Id())
+				}
+			}
+		}
+
+		// Insert the entities that have migrated from the neighboring
+		// shards and mirror the neighbor's entities as ghosts
+		receiveFromShard := func() {
+			migrants, ghosts := settings.shard.receive()
+
+			removeGhosts()
+
+			bounds := world.quadTree.Bounds()
+			for _, g := range ghosts {
+				if !containsBounds(bounds, g.Bounds()) {
+					continue
+				}
+
+				world.Insert(g)
+				ghostIds[g.Id()] = true
+			}
+
+			// A migrant replaces the ghost it may have been mirrored as
+			for _, m := range migrants {
+				world.Insert(m.entity)
+				delete(ghostIds, m.entity.Id())
+
+				if m.actor != nil {
+					if _, exists := actors[m.actor.Id()]; !exists {
+						registerActor(m.actor, m.entity)
+					}
+				}
+			}
+		}
+
+		// Send the entities that have moved out of the
+		// shard's region to the neighboring shards. The ghosts
+		// remain in the world so they are written to the actors.
+		publishToShard := func() {
+			actorOf := func(e entity.Entity) Actor {
+				if id, isActor := entityActors[e.Id()]; isActor {
+					return actors[id]
+				}
+				return nil
+			}
+
+			emigrants := settings.shard.publish(world.quadTree.QueryBounds(world.quadTree.Bounds()), actorOf)
+			for _, e := range emigrants {
+				if a := actorOf(e); a != nil {
+					unregisterActor(a)
+				}
+				world.Remove(e)
+			}
+		}
+
+		// Step the clock forward 1 frame and calculate the
+		// state of the world, then write it to all the actors
+		calculateTick := func() {
+			start := time.Now()
+
+			clock = clock.Tick()
+
+			world.fireTimers(clock.Now(), settings.timerHandlers)
+
+			if settings.shard != nil {
+				receiveFromShard()
+			}
+
+			world.stepTo(clock.Now(), runTick)
+
+			if settings.shard != nil {
+				publishToShard()
+			}
+
+			world.state = world.ToState()
+
+			if len(world.state.Entities) > peakEntities {
+				peakEntities = len(world.state.Entities)
+			}
+
+			writeStart := time.Now()
+
+			// An actor that is still busy with a previous state
+			// isn't waited for, its state is queued by the
+			// SlowActorPolicy and written when it catches up.
+			var busy bool
+			for _, w := range writers {
+				busy = busy || w.busy()
+			}
+
+			// The state's slices are reused by the next tick
+			// so the actors that haven't finished writing
+			// by the deadline need their own copy.
+			state := world.state
+			if settings.writeStateDeadline >= 0 || busy {
+				state = state.copyEntities()
+			}
+
+			written := make(chan struct{}, len(writers))
+			var waiting int
+
+			var dropped []Actor
+			for _, w := range writers {
+				s := w.queued(state, nil)
+				if !w.busy() {
+					s.written = written
+					waiting++
+				}
+
+				if !w.enqueue(s, settings.slowActorPolicy) {
+					dropped = append(dropped, w.actor)
+				}
+			}
+
+			for _, a := range dropped {
+				removeActor(a)
+				if settings.onActorDropped != nil {
+					settings.onActorDropped(ActorDropped{a, clock.Now()})
+				}
+			}
+
+			waitUntil(written, waiting, settings.writeStateDeadline)
+
+			end := time.Now()
+			stats.recordTick(end.Sub(start), period)
+
+			if observer != nil {
+				observer.ObserveTick(TickMetrics{
+					Now:        clock.Now(),
+					Duration:   end.Sub(start),
+					WriteState: end.Sub(writeStart),
+					Actors:     len(actors),
+				})
+			}
+		}
 
 	communicationLoop:
+		tickC = ticker.C()
+		if paused {
+			tickC = nil
+		}
+
 		// # This select prioritizes the following communication events
 		// ## 2 potential events to respond to
 		// 1. Trigger a simulation tick
 		// 2. Halt() method has requested halting
 		select {
-		case <-ticker.C:
+		case tickAt = <-tickC:
 			goto tick
 
 		case hasHalted = <-haltReq:
@@ -271,39 +986,126 @@ func (s *runningSimulation) startLoop(initialState initialWorldState, settings s
 		// 1. Trigger a simulation tick
 		// 2. ConnectActor() method has requested to connect an actor
 		// 3. RemoveActor() method has requested to remove an actor
-		// 4. Halt() method has requested halting
+		// 4. Snapshot() method has requested a snapshot
+		// 5. Schedule() or CancelTimer() has been called
+		// 6. Pause(), Resume(), Step() or SetFPS() has been called
+		// 7. Halt() method has requested halting
 		select {
-		case <-ticker.C:
+		case tickAt = <-tickC:
 			goto tick
 
-		case actor := <-addReq:
+		case req := <-addReq:
 			// a is the new sim.Actor{} to be inserted into the sim
-			a := <-actor.toBeAdded
+			a := req.actor
+
+			if _, exists := actors[a.Id()]; exists {
+				req.result <- ErrActorAlreadyConnected
+				goto communicationLoop
+			}
+
+			if !containsBounds(world.quadTree.Bounds(), a.Entity().Bounds()) {
+				req.result <- ErrEntityOutOfBounds
+				goto communicationLoop
+			}
 
 			world.Insert(a.Entity())
-			actors[a.Id()] = a
+			registerActor(a, a.Entity())
 
 			// signal that the operation was a success
-			actor.wasAdded <- a
+			req.result <- nil
 
 			goto communicationLoop
 
-		case actor := <-removeReq:
-			// a is the new sim.Actor{} to be removed from the sim
-			a := <-actor.toBeRemoved
+		case req := <-removeReq:
+			// a is the sim.Actor{} to be removed from the sim
+			a := req.actor
+
+			if _, exists := actors[a.Id()]; !exists {
+				req.result <- ErrActorNotConnected
+				goto communicationLoop
+			}
 
 			// We use the NextTick of the clock here because we're in between
 			// ticks at the moment and the first part of the next cycle is to
 			// tick the clock forward. So we want our new entity to appear to
 			// be removed on that clock cycle, instead of Now() which has already
 			// been evaluated.
-			world.Insert(entity.Removed{
-				Entity:    a.Entity(),
-				RemovedAt: clock.NextTick()})
-			delete(actors, a.Id())
+			removeActor(a)
 
 			// signal that the operation was a success
-			actor.wasRemoved <- a
+			req.result <- nil
+
+			goto communicationLoop
+
+		case snapshot := <-snapshotReq:
+			ws, err := world.Snapshot(actorIds())
+			snapshot <- snapshotResult{ws, err}
+
+			goto communicationLoop
+
+		case req := <-timerReq:
+			t := req.timer
+
+			if req.cancel {
+				if !world.timers.cancel(t.Id) {
+					req.result <- timerResult{err: ErrTimerNotScheduled}
+					goto communicationLoop
+				}
+
+				req.result <- timerResult{id: t.Id}
+				goto communicationLoop
+			}
+
+			if _, exists := settings.timerHandlers[t.Handler]; !exists {
+				req.result <- timerResult{err: ErrUnknownTimerHandler}
+				goto communicationLoop
+			}
+
+			id := world.timers.schedule(clock.Now(), t.At, t.Handler, t.Data)
+			req.result <- timerResult{id: id}
+
+			goto communicationLoop
+
+		case req := <-controlReq:
+			switch req.op {
+			case controlPause:
+				if !paused && settings.shard != nil {
+					settings.shard.pause()
+				}
+				paused = true
+				req.done <- nil
+
+			case controlResume:
+				if paused {
+					// Don't count the time spent paused as frames
+					// the simulation has fallen behind by.
+					paused = false
+					pacer.reset()
+
+					if settings.shard != nil {
+						settings.shard.resume()
+					}
+				}
+				req.done <- nil
+
+			case controlStep:
+				if !paused {
+					req.done <- ErrSimulationNotPaused
+					break
+				}
+
+				for i := 0; i < req.n; i++ {
+					calculateTick()
+				}
+				req.done <- nil
+
+			case controlSetFPS:
+				settings.fps = req.n
+				period = tickPeriod(req.n)
+				ticker.SetFPS(req.n)
+				pacer = newTickPacer(settings.overrunPolicy, settings.maxCatchUpTicks, period)
+				req.done <- nil
+			}
 
 			goto communicationLoop
 
@@ -314,44 +1116,114 @@ func (s *runningSimulation) startLoop(initialState initialWorldState, settings s
 		panic("unclosed case in simulation communication loop select case")
 
 	tick:
-		clock = clock.Tick()
-		world.stepTo(clock.Now(), runTick)
+		skipped, ticks = pacer.advance(clock, tickAt)
+		stats.recordFrames(skipped, ticks)
 
-		world.state = world.ToState()
+		clock = stime.Clock(int64(clock) + skipped)
 
-		multiWrite.Add(len(actors))
-		for _, a := range actors {
-			go func(a Actor) {
-				a.WriteState(world.state)
-				multiWrite.Done()
-			}(a)
+		for i := 0; i < ticks; i++ {
+			calculateTick()
 		}
-		multiWrite.Wait()
+		ticker.Done()
 
 		goto communicationLoop
 
 	exit:
-		// TODO pre halt cleanup
-		// Signal to Halt() caller that we've finished cleanup
-		hasHalted <- haltedSimulation{world.quadTree}
-
-		// NOTE Will loop forever and won't be garbage collected
-		// Not a big deal because it will only be used once the
-		// server is being torn down and the process is exiting.
-		// Enables Halt() method to be called an infinite number
-		// of times after the simulation has actually halted.
-		go func() {
-			for {
-				hasHalted = <-haltReq
-				hasHalted <- haltedSimulation{world.quadTree}
+		ticker.Stop()
+
+		if settings.drainPeriod > 0 {
+			// Write the final state and then notify every
+			// actor that the simulation is halting.
+			world.state = world.ToState()
+
+			drained := make(chan struct{}, len(writers))
+			for _, w := range writers {
+				s := w.queued(world.state, drained)
+				s.final = true
+				w.enqueue(s, SlowActorCoalesce)
 			}
-		}()
+
+			waitUntil(drained, len(writers), settings.drainPeriod)
+		}
+
+		for _, w := range writers {
+			w.close()
+		}
+
+		if settings.shard != nil {
+			removeGhosts()
+			settings.shard.leave()
+		}
+
+		halted := haltedSimulation{
+			quadTree: world.quadTree,
+			snapshot: &haltedSnapshot{world: world, actors: actorIds()},
+			stats: func() SimulationStats {
+				ts := stats.snapshot()
+
+				s := SimulationStats{
+					Ticks:        ts.Ticks,
+					ActorsSeen:   len(actorsSeen),
+					PeakEntities: peakEntities,
+				}
+
+				if ts.Ticks > 0 {
+					s.AverageTickTime = ts.TotalTickDuration / time.Duration(ts.Ticks)
+				}
+
+				return s
+			}(),
+		}
+
+		for _, cleanup := range settings.onHalt {
+			cleanup(halted)
+		}
+
+		// Release every caller of the public api that
+		// is blocked waiting for the game loop.
+		haltedLoop.sim = halted
+		close(haltedLoop.done)
+
+		// Signal to Halt() caller that we've finished cleanup
+		hasHalted <- halted
 	}()
 }
 
+// Returns true if inner is entirely within outer
+func containsBounds(outer, inner coord.Bounds) bool {
+	return outer.Contains(inner.TopL) && outer.Contains(inner.BotR)
+}
+
 type haltedSimulation struct {
 	quadTree quad.Quad
+
+	snapshot *haltedSnapshot
+	stats    SimulationStats
+}
+
+// The world isn't modified after the simulation has
+// halted so the snapshot is only taken when requested.
+type haltedSnapshot struct {
+	once sync.Once
+
+	world  *World
+	actors []ActorId
+
+	snapshot WorldSnapshot
+	err      error
 }
 
 // Return the quad tree used by the simulation
 func (s haltedSimulation) Quad() quad.Quad { return s.quadTree }
+
+// Return statistics about the lifetime of the simulation
+func (s haltedSimulation) Stats() SimulationStats { return s.stats }
+
+// Return a snapshot of the world when the simulation was halted
+func (s haltedSimulation) Snapshot() (WorldSnapshot, error) {
+	h := s.snapshot
+	h.once.Do(func() {
+		h.snapshot, h.err = h.world.Snapshot(h.actors)
+	})
+	return h.snapshot, h.err
+}
@@ -1,6 +1,11 @@
 package rpg2d_test
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/ghthor/filu/rpg2d"
 	"github.com/ghthor/filu/rpg2d/coord"
 	"github.com/ghthor/filu/rpg2d/entity"
@@ -39,6 +44,74 @@ func (a mockActorEntity) Bounds() coord.Bounds {
 func (a mockActorEntity) ToState() entity.State             { return a }
 func (a mockActorEntity) IsDifferentFrom(entity.State) bool { return true }
 
+type recordingActor struct {
+	mockActor
+
+	mu     sync.Mutex
+	states []stime.Time
+}
+
+func (a *recordingActor) WriteState(s rpg2d.WorldState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.states = append(a.states, s.Time)
+}
+
+func (a *recordingActor) times() []stime.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	times := make([]stime.Time, len(a.states))
+	copy(times, a.states)
+	return times
+}
+
+// An actor that blocks in WriteState until released
+type blockingActor struct {
+	mockActor
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (a blockingActor) WriteState(rpg2d.WorldState) {
+	a.writing <- struct{}{}
+	<-a.release
+}
+
+// An actor that won't finish writing any state until released
+type slowActor struct {
+	recordingActor
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (a *slowActor) WriteState(s rpg2d.WorldState) {
+	select {
+	case a.writing <- struct{}{}:
+	default:
+	}
+	<-a.release
+	a.recordingActor.WriteState(s)
+}
+
+// An actor that records when it was notified of the simulation halting
+type haltingActor struct {
+	recordingActor
+	haltedAt []stime.Time
+}
+
+func (a *haltingActor) SimulationHalting(at stime.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.haltedAt = append(a.haltedAt, at)
+}
+
+type mockUpdatePhase struct{}
+
+func (mockUpdatePhase) Update(e entity.Entity, now stime.Time) entity.Entity {
+	return e
+}
+
 type mockInputPhase struct{}
 
 func (mockInputPhase) ApplyInputsTo(e entity.Entity, now stime.Time) []entity.Entity {
@@ -51,6 +124,10 @@ func (mockNarrowPhase) ResolveCollisions(c *quad.CollisionGroup, now stime.Time)
 	return c.Entities, nil
 }
 
+type mockConcurrentNarrowPhase struct{ mockNarrowPhase }
+
+func (mockConcurrentNarrowPhase) ConcurrencySafe() bool { return true }
+
 func DescribeASimulation(c gospec.Context) {
 	bounds := coord.Bounds{
 		TopL: coord.Cell{-1024, 1024},
@@ -69,6 +146,7 @@ func DescribeASimulation(c gospec.Context) {
 		QuadTree:   quad,
 		TerrainMap: terrainMap,
 
+		UpdatePhaseHandler: mockUpdatePhase{},
 		InputPhaseHandler:  mockInputPhase{},
 		NarrowPhaseHandler: mockNarrowPhase{},
 	}
@@ -90,6 +168,25 @@ func DescribeASimulation(c gospec.Context) {
 		c.Expect(hs.Quad(), Not(IsNil))
 	})
 
+	c.Specify("a simulation will not begin with narrow phase workers", func() {
+		def.NarrowPhaseWorkers = 4
+
+		c.Specify("unless the narrow phase handler is concurrency safe", func() {
+			def.NarrowPhaseHandler = mockConcurrentNarrowPhase{}
+
+			rs, err := def.Begin()
+			c.Assume(err, IsNil)
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("if the narrow phase handler isn't concurrency safe", func() {
+			_, err := def.Begin()
+			c.Expect(err, Equals, rpg2d.ErrNarrowPhaseNotConcurrencySafe)
+		})
+	})
+
 	c.Specify("a simulation can have actors", func() {
 		rs, err := def.Begin()
 		c.Assume(err, IsNil)
@@ -128,4 +225,471 @@ func DescribeASimulation(c gospec.Context) {
 			c.Expect(len(entities), Equals, 0)
 		})
 	})
+
+	c.Specify("a simulation driven by a manual ticker", func() {
+		ticker := rpg2d.NewManualTicker(time.Time{})
+
+		def.Now = stime.Time(10)
+		def.TickSource = ticker
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		a := &recordingActor{mockActor: mockActor{
+			id: 1,
+			mockActorEntity: mockActorEntity{
+				id: 2,
+			},
+		}}
+
+		rs.ConnectActor(a)
+
+		c.Specify("will only tick when stepped", func() {
+			c.Expect(len(a.times()), Equals, 0)
+
+			c.Expect(ticker.Step(3), Equals, 3)
+			c.Expect(a.times(), ContainsExactly, []stime.Time{11, 12, 13})
+			c.Expect(rs.TickStats().Ticks, Equals, uint64(3))
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will not tick after being halted", func() {
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			c.Expect(ticker.Step(1), Equals, 0)
+			c.Expect(len(a.times()), Equals, 0)
+		})
+	})
+
+	c.Specify("a simulation driven as fast as possible", func() {
+		def.TickSource = rpg2d.AsFastAsPossible{}
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		a := &recordingActor{mockActor: mockActor{
+			id: 1,
+			mockActorEntity: mockActorEntity{
+				id: 2,
+			},
+		}}
+
+		rs.ConnectActor(a)
+
+		// Wait for more ticks than a real time simulation
+		// running at 40 fps could calculate.
+		deadline := time.Now().Add(time.Second)
+		for len(a.times()) < 100 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		_, err = rs.Halt()
+		c.Assume(err, IsNil)
+
+		// Every tick should have been calculated, in order
+		times := a.times()
+		c.Assume(len(times), Satisfies, len(times) >= 100)
+		c.Expect(times[len(times)-1]-times[0], Equals, stime.Time(len(times)-1))
+	})
+
+	c.Specify("a simulation with an observer", func() {
+		ticker := rpg2d.NewManualTicker(time.Time{})
+		metrics := rpg2d.NewMetricsRecorder()
+
+		def.TickSource = ticker
+		def.Observer = metrics
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		rs.ConnectActor(mockActor{
+			id: 1,
+			mockActorEntity: mockActorEntity{
+				id: 2,
+			},
+		})
+
+		c.Assume(ticker.Step(2), Equals, 2)
+
+		_, err = rs.Halt()
+		c.Assume(err, IsNil)
+
+		c.Expect(metrics.Update.Count(), Equals, uint64(2))
+		c.Expect(metrics.Narrow.Count(), Equals, uint64(2))
+		c.Expect(metrics.Tick.Count(), Equals, uint64(2))
+		c.Expect(metrics.WriteState.Count(), Equals, uint64(2))
+	})
+
+	c.Specify("a simulation's clock", func() {
+		def.TickSource = rpg2d.AsFastAsPossible{}
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		a := &recordingActor{mockActor: mockActor{
+			id: 1,
+			mockActorEntity: mockActorEntity{
+				id: 2,
+			},
+		}}
+
+		rs.ConnectActor(a)
+		c.Assume(rs.Pause(), IsNil)
+
+		paused := a.times()
+
+		c.Specify("will not tick while paused", func() {
+			time.Sleep(10 * time.Millisecond)
+			c.Expect(a.times(), ContainsExactly, paused)
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("can be stepped while paused", func() {
+			c.Expect(rs.Step(2), IsNil)
+
+			stepped := a.times()[len(paused):]
+			c.Assume(len(stepped), Equals, 2)
+			c.Expect(stepped[1], Equals, stepped[0]+1)
+
+			if len(paused) > 0 {
+				c.Expect(stepped[0], Equals, paused[len(paused)-1]+1)
+			}
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("can only be stepped while paused", func() {
+			c.Assume(rs.Resume(), IsNil)
+			c.Expect(rs.Step(1), Equals, rpg2d.ErrSimulationNotPaused)
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will tick after being resumed", func() {
+			c.Assume(rs.Resume(), IsNil)
+
+			deadline := time.Now().Add(time.Second)
+			for len(a.times()) <= len(paused) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+
+			c.Expect(len(a.times()), Satisfies, len(a.times()) > len(paused))
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("can have its fps changed", func() {
+			c.Expect(rs.SetFPS(0), Equals, rpg2d.ErrInvalidFPS)
+			c.Expect(rs.SetFPS(60), IsNil)
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("can not be controlled after halting", func() {
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			c.Expect(rs.Pause(), Equals, rpg2d.ErrSimulationHalted)
+			c.Expect(rs.Resume(), Equals, rpg2d.ErrSimulationHalted)
+			c.Expect(rs.Step(1), Equals, rpg2d.ErrSimulationHalted)
+		})
+	})
+
+	c.Specify("a simulation's actor management", func() {
+		ticker := rpg2d.NewManualTicker(time.Time{})
+		def.TickSource = ticker
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		a := mockActor{
+			id: 1,
+			mockActorEntity: mockActorEntity{
+				id: 2,
+			},
+		}
+
+		ctx := context.Background()
+		c.Assume(rs.ConnectActorContext(ctx, a), IsNil)
+
+		c.Specify("will not connect an actor twice", func() {
+			err := rs.ConnectActorContext(ctx, a)
+			c.Expect(errors.Is(err, rpg2d.ErrActorAlreadyConnected), IsTrue)
+
+			var actorErr *rpg2d.ActorError
+			c.Assume(errors.As(err, &actorErr), IsTrue)
+			c.Expect(actorErr.Actor, Equals, rpg2d.ActorId(1))
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will not connect an actor outside of the world", func() {
+			err := rs.ConnectActorContext(ctx, mockActor{
+				id: 2,
+				mockActorEntity: mockActorEntity{
+					id:   3,
+					cell: coord.Cell{2048, 0},
+				},
+			})
+			c.Expect(errors.Is(err, rpg2d.ErrEntityOutOfBounds), IsTrue)
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will not remove an actor that isn't connected", func() {
+			c.Assume(rs.RemoveActorContext(ctx, a), IsNil)
+
+			err := rs.RemoveActorContext(ctx, a)
+			c.Expect(errors.Is(err, rpg2d.ErrActorNotConnected), IsTrue)
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will stop waiting when the context is done", func() {
+			b := blockingActor{
+				mockActor: mockActor{
+					id: 2,
+					mockActorEntity: mockActorEntity{
+						id: 3,
+					},
+				},
+				writing: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+			c.Assume(rs.ConnectActorContext(ctx, b), IsNil)
+
+			stepped := make(chan int)
+			go func() { stepped <- ticker.Step(1) }()
+
+			// The game loop is now blocked writing to the actor
+			<-b.writing
+
+			timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+
+			err := rs.RemoveActorContext(timeout, a)
+			c.Expect(errors.Is(err, context.DeadlineExceeded), IsTrue)
+
+			close(b.release)
+			c.Expect(<-stepped, Equals, 1)
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will release callers once halted", func() {
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			err = rs.ConnectActorContext(ctx, a)
+			c.Expect(errors.Is(err, rpg2d.ErrSimulationHalted), IsTrue)
+
+			err = rs.RemoveActorContext(ctx, a)
+			c.Expect(errors.Is(err, rpg2d.ErrSimulationHalted), IsTrue)
+
+			rs.ConnectActor(a)
+			rs.RemoveActor(a)
+		})
+	})
+
+	c.Specify("a simulation with a slow actor", func() {
+		ticker := rpg2d.NewManualTicker(time.Time{})
+		def.TickSource = ticker
+		def.WriteStateDeadline = 20 * time.Millisecond
+
+		var dropped []rpg2d.ActorDropped
+		def.OnActorDropped = func(e rpg2d.ActorDropped) {
+			dropped = append(dropped, e)
+		}
+
+		fast := &recordingActor{mockActor: mockActor{
+			id:              1,
+			mockActorEntity: mockActorEntity{id: 1},
+		}}
+
+		slow := &slowActor{
+			recordingActor: recordingActor{mockActor: mockActor{
+				id:              2,
+				mockActorEntity: mockActorEntity{id: 2},
+			}},
+			writing: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+
+		waitFor := func(a *recordingActor, n int) []stime.Time {
+			deadline := time.Now().Add(time.Second)
+			for len(a.times()) < n && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			return a.times()
+		}
+
+		// Steps 3 ticks, the 1st is being written to the slow actor,
+		// the 2nd is queued and the 3rd won't fit in the queue.
+		run := func() rpg2d.RunningSimulation {
+			rs, err := def.Begin()
+			c.Assume(err, IsNil)
+
+			rs.ConnectActor(fast)
+			rs.ConnectActor(slow)
+
+			c.Assume(ticker.Step(1), Equals, 1)
+			<-slow.writing
+			c.Assume(ticker.Step(2), Equals, 2)
+			c.Expect(waitFor(fast, 3), ContainsExactly, []stime.Time{1, 2, 3})
+
+			close(slow.release)
+			return rs
+		}
+
+		c.Specify("will skip the newest state", func() {
+			def.SlowActorPolicy = rpg2d.SlowActorSkip
+			rs := run()
+
+			c.Expect(waitFor(&slow.recordingActor, 2), ContainsExactly, []stime.Time{1, 2})
+			c.Expect(len(dropped), Equals, 0)
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will coalesce to the newest state", func() {
+			def.SlowActorPolicy = rpg2d.SlowActorCoalesce
+			rs := run()
+
+			c.Expect(waitFor(&slow.recordingActor, 2), ContainsExactly, []stime.Time{1, 3})
+			c.Expect(len(dropped), Equals, 0)
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will disconnect the actor", func() {
+			def.SlowActorPolicy = rpg2d.SlowActorDisconnect
+			rs := run()
+
+			c.Assume(len(dropped), Equals, 1)
+			c.Expect(dropped[0].Actor.Id(), Equals, rpg2d.ActorId(2))
+			c.Expect(dropped[0].At, Equals, stime.Time(3))
+
+			err := rs.RemoveActorContext(context.Background(), slow)
+			c.Expect(errors.Is(err, rpg2d.ErrActorNotConnected), IsTrue)
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("will not wait for the actor while it's still writing a previous state", func() {
+			def.SlowActorPolicy = rpg2d.SlowActorSkip
+			def.WriteStateDeadline = 200 * time.Millisecond
+
+			rs, err := def.Begin()
+			c.Assume(err, IsNil)
+
+			rs.ConnectActor(fast)
+			rs.ConnectActor(slow)
+
+			c.Assume(ticker.Step(1), Equals, 1)
+			<-slow.writing
+
+			start := time.Now()
+			c.Assume(ticker.Step(2), Equals, 2)
+			c.Expect(time.Since(start) < def.WriteStateDeadline, IsTrue)
+
+			close(slow.release)
+			c.Expect(waitFor(&slow.recordingActor, 2), ContainsExactly, []stime.Time{1, 2})
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+	})
+
+	c.Specify("a simulation that is halted", func() {
+		ticker := rpg2d.NewManualTicker(time.Time{})
+		def.TickSource = ticker
+
+		a := &haltingActor{recordingActor: recordingActor{mockActor: mockActor{
+			id:              1,
+			mockActorEntity: mockActorEntity{id: 1},
+		}}}
+
+		run := func() rpg2d.RunningSimulation {
+			rs, err := def.Begin()
+			c.Assume(err, IsNil)
+
+			rs.ConnectActor(a)
+			c.Assume(ticker.Step(2), Equals, 2)
+			return rs
+		}
+
+		c.Specify("will flush a final state and notify actors during the drain period", func() {
+			def.DrainPeriod = time.Second
+			rs := run()
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			c.Expect(a.times(), ContainsExactly, []stime.Time{1, 2, 2})
+			c.Expect(a.haltedAt, ContainsExactly, []stime.Time{2})
+		})
+
+		c.Specify("will not notify actors without a drain period", func() {
+			rs := run()
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			c.Expect(len(a.haltedAt), Equals, 0)
+		})
+
+		c.Specify("will call the cleanup hooks in order before returning", func() {
+			var calls []int
+			def.OnHalt = []func(rpg2d.HaltedSimulation){
+				func(hs rpg2d.HaltedSimulation) {
+					c.Expect(hs.Stats().Ticks, Equals, uint64(2))
+					calls = append(calls, 1)
+				},
+				func(rpg2d.HaltedSimulation) { calls = append(calls, 2) },
+			}
+
+			rs := run()
+
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+			c.Expect(calls, ContainsExactly, []int{1, 2})
+		})
+
+		c.Specify("will report statistics about its lifetime", func() {
+			rs := run()
+			rs.ConnectActor(mockActor{
+				id:              2,
+				mockActorEntity: mockActorEntity{id: 2, cell: coord.Cell{1, 1}},
+			})
+			c.Assume(ticker.Step(1), Equals, 1)
+
+			rs.RemoveActor(a)
+			c.Assume(ticker.Step(2), Equals, 2)
+
+			hs, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			stats := hs.Stats()
+			c.Expect(stats.Ticks, Equals, uint64(5))
+			c.Expect(stats.ActorsSeen, Equals, 2)
+			c.Expect(stats.PeakEntities, Equals, 2)
+			c.Expect(stats.AverageTickTime > 0, IsTrue)
+		})
+	})
 }
@@ -0,0 +1,145 @@
+package rpg2d
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// A WorldSnapshot is a serializable copy of the
+// state of the world that can be used to begin
+// a simulation where a previous one had stopped.
+type WorldSnapshot struct {
+	Time       stime.Time
+	Entities   []entity.Entity
+	TerrainMap TerrainMap
+
+	// The actors that were connected to the simulation
+	// when the snapshot was taken. Actors aren't
+	// restored by BeginFrom and must be reconnected.
+	Actors []ActorId
+
+	// The pending timers sorted by when they will fire
+	Timers []Timer
+}
+
+// Entities are encoded as interface values. Every
+// concrete entity type that will be contained in a
+// snapshot must be registered before it can be
+// encoded or decoded.
+func RegisterEntity(e entity.Entity) {
+	gob.Register(e)
+}
+
+func init() {
+	RegisterEntity(entity.Removed{})
+}
+
+// The encoded form of a WorldSnapshot. The terrain
+// map is encoded as a string to keep it compact.
+type worldSnapshot struct {
+	Time     stime.Time
+	Entities []entity.Entity
+	Terrain  TerrainMapStateSlice
+	Actors   []ActorId
+	Timers   []Timer
+}
+
+// Encode the snapshot using encoding/gob.
+func (s WorldSnapshot) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(worldSnapshot{
+		Time:     s.Time,
+		Entities: s.Entities,
+		Terrain: TerrainMapStateSlice{
+			Bounds:  s.TerrainMap.Bounds,
+			Terrain: s.TerrainMap.String(),
+		},
+		Actors: s.Actors,
+		Timers: s.Timers,
+	})
+}
+
+// Decode a snapshot that was encoded with WorldSnapshot.Encode.
+func DecodeWorldSnapshot(r io.Reader) (WorldSnapshot, error) {
+	var s worldSnapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return WorldSnapshot{}, err
+	}
+
+	terrainMap, err := NewTerrainMap(s.Terrain.Bounds, s.Terrain.Terrain)
+	if err != nil {
+		return WorldSnapshot{}, err
+	}
+
+	return WorldSnapshot{
+		Time:       s.Time,
+		Entities:   s.Entities,
+		TerrainMap: terrainMap,
+		Actors:     s.Actors,
+		Timers:     s.Timers,
+	}, nil
+}
+
+// Returns a snapshot of the world. The snapshot's slices and
+// terrain map are copies, but the entities and the timers'
+// Data are the world's values. An entity, or Data, that is
+// a pointer is shared with the world until the snapshot has
+// been encoded and decoded.
+func (world World) Snapshot(actors []ActorId) (WorldSnapshot, error) {
+	terrainMap, err := world.terrain.Clone()
+	if err != nil {
+		return WorldSnapshot{}, err
+	}
+
+	ids := make([]ActorId, len(actors))
+	copy(ids, actors)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// The ghosts of a shard are owned by its neighbors
+	var entities []entity.Entity
+	for _, e := range world.quadTree.QueryBounds(world.quadTree.Bounds()) {
+		if _, isGhost := e.(Ghost); !isGhost {
+			entities = append(entities, e)
+		}
+	}
+
+	sort.Slice(entities, func(i, j int) bool { return entities[i].Id() < entities[j].Id() })
+
+	return WorldSnapshot{
+		Time:       world.time,
+		Entities:   entities,
+		TerrainMap: terrainMap,
+		Actors:     ids,
+		Timers:     world.timers.timers(),
+	}, nil
+}
+
+var ErrSnapshotBoundsMismatch = errors.New("snapshot terrain map bounds must match the simulation defination's quad tree")
+
+// Begin a simulation from the state of the world in the
+// snapshot. The definition's Now, TerrainMap and Timers are
+// replaced by the snapshot's and the snapshot's entities are
+// inserted into the definition's QuadTree, which should be empty.
+func (s SimulationDef) BeginFrom(snapshot WorldSnapshot) (RunningSimulation, error) {
+	if s.QuadTree == nil {
+		return nil, ErrMustProvideAQuadtree
+	}
+
+	if snapshot.TerrainMap.Bounds != s.QuadTree.Bounds() {
+		return nil, ErrSnapshotBoundsMismatch
+	}
+
+	s.Now = snapshot.Time
+	s.TerrainMap = snapshot.TerrainMap
+	s.Timers = snapshot.Timers
+
+	for _, e := range snapshot.Entities {
+		s.QuadTree = s.QuadTree.Insert(e)
+	}
+
+	return s.Begin()
+}
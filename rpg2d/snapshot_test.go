@@ -0,0 +1,172 @@
+package rpg2d_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d"
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func init() {
+	rpg2d.RegisterEntity(entitytest.MockEntity{})
+}
+
+// An actor that is represented by an entity
+// that can be encoded in a snapshot.
+type snapshotActor struct {
+	id rpg2d.ActorId
+	entitytest.MockEntity
+}
+
+func (a snapshotActor) Id() rpg2d.ActorId         { return a.id }
+func (a snapshotActor) Entity() entity.Entity     { return a.MockEntity }
+func (snapshotActor) WriteState(rpg2d.WorldState) {}
+
+func DescribeWorldSnapshot(c gospec.Context) {
+	bounds := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	terrainMap, err := rpg2d.NewTerrainMap(bounds, string(rpg2d.TT_GRASS))
+	c.Assume(err, IsNil)
+
+	newQuad := func() quad.Quad {
+		q, err := quad.New(bounds, 10, nil)
+		c.Assume(err, IsNil)
+		return q
+	}
+
+	c.Specify("a world snapshot", func() {
+		snapshot := rpg2d.WorldSnapshot{
+			Time: stime.Time(5),
+			Entities: []entity.Entity{
+				entitytest.MockEntity{EntityId: 0, EntityCell: coord.Cell{1, 1}},
+				entity.Removed{
+					Entity:    entitytest.MockEntity{EntityId: 1},
+					RemovedAt: stime.Time(5),
+				},
+			},
+			TerrainMap: terrainMap,
+			Actors:     []rpg2d.ActorId{1},
+		}
+
+		c.Specify("can be encoded and decoded", func() {
+			buf := bytes.NewBuffer(nil)
+			c.Assume(snapshot.Encode(buf), IsNil)
+
+			decoded, err := rpg2d.DecodeWorldSnapshot(buf)
+			c.Assume(err, IsNil)
+
+			c.Expect(decoded.Time, Equals, snapshot.Time)
+			c.Expect(decoded.Entities, ContainsExactly, snapshot.Entities)
+			c.Expect(decoded.TerrainMap.String(), Equals, terrainMap.String())
+			c.Expect(decoded.Actors, ContainsExactly, snapshot.Actors)
+		})
+	})
+
+	c.Specify("a simulation", func() {
+		ticker := rpg2d.NewManualTicker(time.Time{})
+
+		def := rpg2d.SimulationDef{
+			FPS:        40,
+			TickSource: ticker,
+
+			Now:        stime.Time(10),
+			QuadTree:   newQuad(),
+			TerrainMap: terrainMap,
+
+			UpdatePhaseHandler: mockUpdatePhase{},
+			InputPhaseHandler:  mockInputPhase{},
+			NarrowPhaseHandler: mockNarrowPhase{},
+		}
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+
+		a := snapshotActor{
+			id:         1,
+			MockEntity: entitytest.MockEntity{EntityId: 2, EntityCell: coord.Cell{3, 3}},
+		}
+
+		rs.ConnectActor(a)
+		c.Assume(ticker.Step(2), Equals, 2)
+
+		c.Specify("can be snapshotted while running", func() {
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+
+			c.Expect(snapshot.Time, Equals, stime.Time(12))
+			c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{a.Entity()})
+			c.Expect(snapshot.Actors, ContainsExactly, []rpg2d.ActorId{1})
+
+			_, err = rs.Halt()
+			c.Assume(err, IsNil)
+		})
+
+		c.Specify("can be snapshotted after halting", func() {
+			hs, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			snapshot, err := hs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Time, Equals, stime.Time(12))
+			c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{a.Entity()})
+
+			snapshot, err = rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Time, Equals, stime.Time(12))
+		})
+
+		c.Specify("can be restored from a snapshot", func() {
+			hs, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			snapshot, err := hs.Snapshot()
+			c.Assume(err, IsNil)
+
+			buf := bytes.NewBuffer(nil)
+			c.Assume(snapshot.Encode(buf), IsNil)
+
+			snapshot, err = rpg2d.DecodeWorldSnapshot(buf)
+			c.Assume(err, IsNil)
+
+			def.QuadTree = newQuad()
+			def.TickSource = rpg2d.NewManualTicker(time.Time{})
+
+			rs, err := def.BeginFrom(snapshot)
+			c.Assume(err, IsNil)
+
+			hs, err = rs.Halt()
+			c.Assume(err, IsNil)
+
+			restored, err := hs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(restored.Time, Equals, stime.Time(12))
+			c.Expect(hs.Quad().QueryCell(coord.Cell{3, 3}), ContainsExactly, []entity.Entity{a.Entity()})
+		})
+
+		c.Specify("will not be restored from a snapshot with different bounds", func() {
+			_, err := rs.Halt()
+			c.Assume(err, IsNil)
+
+			q, err := quad.New(coord.Bounds{
+				TopL: coord.Cell{-4, 4},
+				BotR: coord.Cell{3, -3},
+			}, 10, nil)
+			c.Assume(err, IsNil)
+
+			def.QuadTree = q
+			_, err = def.BeginFrom(rpg2d.WorldSnapshot{TerrainMap: terrainMap})
+			c.Expect(err, Equals, rpg2d.ErrSnapshotBoundsMismatch)
+		})
+	})
+}
@@ -15,6 +15,15 @@ func TestUnitSpecs(t *testing.T) {
 	r.AddSpec(DescribeWorldState)
 
 	r.AddSpec(DescribeASimulation)
+	r.AddSpec(rpg2d.DescribeTickPacer)
+	r.AddSpec(DescribeHistogram)
+	r.AddSpec(DescribeWorldSnapshot)
+	r.AddSpec(DescribeActorViews)
+	r.AddSpec(DescribeInputQueue)
+	r.AddSpec(DescribeRegistry)
+	r.AddSpec(DescribeShardGroup)
+	r.AddSpec(DescribeTimers)
+	r.AddSpec(rpg2d.DescribeTimerWheel)
 
 	gospec.MainGoTest(r, t)
 }
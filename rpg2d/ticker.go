@@ -0,0 +1,202 @@
+package rpg2d
+
+import (
+	"sync"
+	"time"
+)
+
+// A TickSource is used by a simulation to decide
+// when the next tick should be calculated. The
+// simulation will call Start once when it begins
+// and Stop on the returned Ticker when it halts.
+type TickSource interface {
+	Start(fps int) Ticker
+}
+
+// A Ticker delivers the times at which the
+// simulation should calculate a tick.
+type Ticker interface {
+	C() <-chan time.Time
+
+	// Called by the simulation after a tick has been calculated
+	// and its state has been written to the actors, or the
+	// simulation's WriteStateDeadline has passed.
+	Done()
+
+	// Change the rate ticks are delivered at.
+	SetFPS(fps int)
+
+	Stop()
+}
+
+func tickPeriod(fps int) time.Duration {
+	if fps <= 0 {
+		fps = 1
+	}
+
+	return time.Second / time.Duration(fps)
+}
+
+// RealTime is the default TickSource. Ticks are
+// delivered using a time.Ticker at the rate of
+// the simulation's FPS.
+type RealTime struct{}
+
+type realTimeTicker struct {
+	*time.Ticker
+}
+
+func (RealTime) Start(fps int) Ticker {
+	return realTimeTicker{time.NewTicker(tickPeriod(fps))}
+}
+
+func (t realTimeTicker) C() <-chan time.Time { return t.Ticker.C }
+func (realTimeTicker) Done()                 {}
+func (t realTimeTicker) SetFPS(fps int)      { t.Ticker.Reset(tickPeriod(fps)) }
+
+// AsFastAsPossible is a TickSource that will deliver
+// the next tick as soon as the previous tick has
+// been calculated. The time delivered with each tick
+// advances by the simulation's tick period from
+// the From time so offline batch simulations will
+// produce the same times as a real time simulation.
+type AsFastAsPossible struct {
+	From time.Time
+}
+
+type fastTicker struct {
+	c    chan time.Time
+	done chan struct{}
+	stop chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	period time.Duration
+}
+
+func (s AsFastAsPossible) Start(fps int) Ticker {
+	t := &fastTicker{
+		c:    make(chan time.Time),
+		done: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+
+		period: tickPeriod(fps),
+	}
+
+	go func(now time.Time) {
+		for {
+			t.mu.Lock()
+			now = now.Add(t.period)
+			t.mu.Unlock()
+
+			select {
+			case t.c <- now:
+			case <-t.stop:
+				return
+			}
+
+			select {
+			case <-t.done:
+			case <-t.stop:
+				return
+			}
+		}
+	}(s.From)
+
+	return t
+}
+
+func (t *fastTicker) C() <-chan time.Time { return t.c }
+func (t *fastTicker) Done()               { t.done <- struct{}{} }
+func (t *fastTicker) Stop()               { t.once.Do(func() { close(t.stop) }) }
+
+func (t *fastTicker) SetFPS(fps int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.period = tickPeriod(fps)
+}
+
+// A ManualTicker is a TickSource that will only
+// deliver a tick when Step is called. It is used
+// to drive a simulation deterministically in tests.
+// A ManualTicker can only be used by a single simulation.
+type ManualTicker struct {
+	c    chan time.Time
+	done chan struct{}
+	stop chan struct{}
+	once sync.Once
+
+	// Serializes calls to Step
+	step sync.Mutex
+
+	mu     sync.Mutex
+	now    time.Time
+	period time.Duration
+}
+
+// Create a ManualTicker that will deliver
+// ticks that begin after the start time.
+func NewManualTicker(start time.Time) *ManualTicker {
+	return &ManualTicker{
+		c:    make(chan time.Time),
+		done: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+
+		now:    start,
+		period: tickPeriod(0),
+	}
+}
+
+func (t *ManualTicker) Start(fps int) Ticker {
+	t.SetFPS(fps)
+	return t
+}
+
+func (t *ManualTicker) SetFPS(fps int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.period = tickPeriod(fps)
+}
+
+// Step will deliver n ticks to the simulation and blocks
+// until each one has been calculated and written to the
+// actors, waiting no longer than the simulation's
+// WriteStateDeadline for each tick. Returns the number of
+// ticks that were calculated, which will be less than n if
+// the simulation has been halted.
+//
+// A paused simulation doesn't receive ticks from its ticker,
+// so Step will block until the simulation is resumed or
+// halted. Use the simulation's Step method while it's paused.
+func (t *ManualTicker) Step(n int) int {
+	t.step.Lock()
+	defer t.step.Unlock()
+
+	for i := 0; i < n; i++ {
+		t.mu.Lock()
+		now := t.now.Add(t.period)
+		t.mu.Unlock()
+
+		select {
+		case t.c <- now:
+		case <-t.stop:
+			return i
+		}
+
+		t.mu.Lock()
+		t.now = now
+		t.mu.Unlock()
+
+		select {
+		case <-t.done:
+		case <-t.stop:
+			return i
+		}
+	}
+
+	return n
+}
+
+func (t *ManualTicker) C() <-chan time.Time { return t.c }
+func (t *ManualTicker) Done()               { t.done <- struct{}{} }
+func (t *ManualTicker) Stop()               { t.once.Do(func() { close(t.stop) }) }
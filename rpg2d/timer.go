@@ -0,0 +1,251 @@
+package rpg2d
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+type TimerId uint64
+
+// A Timer will fire the named handler at the start of the tick
+// at At, before the update phase. The Data is passed to the
+// handler and is encoded with the timer in a WorldSnapshot,
+// so its concrete type must be registered with encoding/gob.
+type Timer struct {
+	Id      TimerId
+	At      stime.Time
+	Handler string
+	Data    interface{}
+}
+
+// A TimerHandler is called when a timer that
+// was scheduled with the handler's name fires.
+type TimerHandler interface {
+	FireTimer(Timer, TimerWorld)
+}
+
+// Convenience type so timer handlers can be
+// written as closures or as functions.
+type TimerHandlerFn func(Timer, TimerWorld)
+
+func (f TimerHandlerFn) FireTimer(t Timer, w TimerWorld) {
+	f(t, w)
+}
+
+// The world as seen by a TimerHandler.
+type TimerWorld interface {
+	Now() stime.Time
+
+	QueryBounds(coord.Bounds) []entity.Entity
+
+	// Insert an entity into the world. It will be
+	// included in all of the phases of the tick.
+	Insert(entity.Entity)
+
+	// Mark an entity as removed on the tick.
+	Remove(entity.Entity)
+
+	// Schedule another timer, such as the next
+	// step of a repeating day/night cycle.
+	Schedule(at stime.Time, handler string, data interface{}) TimerId
+}
+
+var ErrUnknownTimerHandler = errors.New("no timer handler has been registered with that name")
+var ErrTimerNotScheduled = errors.New("timer isn't scheduled")
+var ErrDuplicateTimerId = errors.New("a timer is already scheduled with that id")
+
+// The number of slots in a timer wheel. Timers that are
+// scheduled further in the future than the number of slots
+// remain in their slot until the wheel has come around
+// to the tick they are scheduled for.
+const timerWheelSize = 256
+
+// A timerWheel is a hashed wheel of the pending timers. A
+// timer is placed in the slot for the tick it is scheduled
+// for. Only the simulation's go routine uses the wheel.
+type timerWheel struct {
+	slots  [timerWheelSize][]Timer
+	nextId TimerId
+
+	// The location of every pending timer
+	pending map[TimerId]stime.Time
+}
+
+func newTimerWheel() *timerWheel {
+	return &timerWheel{
+		pending: make(map[TimerId]stime.Time),
+	}
+}
+
+func timerSlot(at stime.Time) int {
+	slot := int(at % timerWheelSize)
+	if slot < 0 {
+		slot += timerWheelSize
+	}
+	return slot
+}
+
+// Schedule a timer that will fire on the first tick at or
+// after at. Timers scheduled for a tick that has already
+// been calculated will fire on the next tick.
+func (w *timerWheel) schedule(now stime.Time, at stime.Time, handler string, data interface{}) TimerId {
+	return w.add(now, Timer{
+		At:      at,
+		Handler: handler,
+		Data:    data,
+	})
+}
+
+// Add the timer to the wheel. A timer without an id is assigned
+// the next id. A timer scheduled for a tick that has already
+// been calculated will fire on the next tick.
+func (w *timerWheel) add(now stime.Time, t Timer) TimerId {
+	if t.At <= now {
+		t.At = stime.Clock(now).NextTick()
+	}
+
+	if t.Id == 0 {
+		w.nextId++
+		t.Id = w.nextId
+	} else if t.Id > w.nextId {
+		w.nextId = t.Id
+	}
+
+	slot := timerSlot(t.At)
+	w.slots[slot] = append(w.slots[slot], t)
+	w.pending[t.Id] = t.At
+
+	return t.Id
+}
+
+// Add the timers a simulation begins with. The timers with an
+// id are added first so they aren't reused by the timers without.
+func (w *timerWheel) addAll(now stime.Time, timers []Timer) {
+	for _, t := range timers {
+		if t.Id != 0 {
+			w.add(now, t)
+		}
+	}
+
+	for _, t := range timers {
+		if t.Id == 0 {
+			w.add(now, t)
+		}
+	}
+}
+
+func (w *timerWheel) cancel(id TimerId) bool {
+	at, exists := w.pending[id]
+	if !exists {
+		return false
+	}
+
+	slot := timerSlot(at)
+	for i, t := range w.slots[slot] {
+		if t.Id == id {
+			w.slots[slot] = append(w.slots[slot][:i], w.slots[slot][i+1:]...)
+			break
+		}
+	}
+
+	delete(w.pending, id)
+	return true
+}
+
+// Remove and return the timers that fire in the ticks after
+// last up to and including now, sorted by when they were
+// scheduled to fire and then in the order they were scheduled.
+// Every slot of the ticks is checked so the timers of ticks that
+// were skipped by the simulation fire late, instead of waiting
+// for the wheel to come around again. Timers scheduled for a
+// later round of the wheel remain in their slot.
+func (w *timerWheel) expire(last, now stime.Time) []Timer {
+	ticks := now - last
+	if ticks > timerWheelSize {
+		ticks = timerWheelSize
+	}
+
+	var expired []Timer
+	for at := now - ticks + 1; at <= now; at++ {
+		slot := timerSlot(at)
+
+		var remaining []Timer
+		for _, t := range w.slots[slot] {
+			if t.At <= now {
+				expired = append(expired, t)
+				delete(w.pending, t.Id)
+			} else {
+				remaining = append(remaining, t)
+			}
+		}
+
+		w.slots[slot] = remaining
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].At != expired[j].At {
+			return expired[i].At < expired[j].At
+		}
+		return expired[i].Id < expired[j].Id
+	})
+
+	return expired
+}
+
+// Returns all of the pending timers sorted
+// by when they will fire and then by id.
+func (w *timerWheel) timers() []Timer {
+	timers := make([]Timer, 0, len(w.pending))
+	for _, slot := range w.slots {
+		timers = append(timers, slot...)
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		if timers[i].At != timers[j].At {
+			return timers[i].At < timers[j].At
+		}
+		return timers[i].Id < timers[j].Id
+	})
+
+	return timers
+}
+
+// Implements TimerWorld for the timers that fire on a tick
+type timerWorld struct {
+	world *World
+	now   stime.Time
+}
+
+func (w timerWorld) Now() stime.Time { return w.now }
+
+func (w timerWorld) QueryBounds(b coord.Bounds) []entity.Entity {
+	return w.world.quadTree.QueryBounds(b)
+}
+
+func (w timerWorld) Insert(e entity.Entity) { w.world.Insert(e) }
+
+func (w timerWorld) Remove(e entity.Entity) {
+	w.world.Insert(entity.Removed{
+		Entity:    e,
+		RemovedAt: w.now,
+	})
+}
+
+func (w timerWorld) Schedule(at stime.Time, handler string, data interface{}) TimerId {
+	return w.world.timers.schedule(w.now, at, handler, data)
+}
+
+// Fire all the timers scheduled for the ticks after the world's
+// time up to now. Timers scheduled by a handler for now will
+// fire on the next tick.
+func (world *World) fireTimers(now stime.Time, handlers map[string]TimerHandler) {
+	for _, t := range world.timers.expire(world.time, now) {
+		if h, exists := handlers[t.Handler]; exists {
+			h.FireTimer(t, timerWorld{world, now})
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package rpg2d_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d"
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func DescribeTimers(c gospec.Context) {
+	bounds := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	terrainMap, err := rpg2d.NewTerrainMap(bounds, string(rpg2d.TT_GRASS))
+	c.Assume(err, IsNil)
+
+	newQuad := func() quad.Quad {
+		q, err := quad.New(bounds, 10, nil)
+		c.Assume(err, IsNil)
+		return q
+	}
+
+	respawned := entitytest.MockEntity{EntityId: 1, EntityCell: coord.Cell{2, 2}}
+
+	// The times the update phase has seen the respawned entity
+	var updated []stime.Time
+
+	// The times the repeating timer has fired
+	var repeated []stime.Time
+
+	ticker := rpg2d.NewManualTicker(time.Time{})
+
+	def := rpg2d.SimulationDef{
+		FPS:        40,
+		TickSource: ticker,
+
+		QuadTree:   newQuad(),
+		TerrainMap: terrainMap,
+
+		TimerHandlers: map[string]rpg2d.TimerHandler{
+			"respawn": rpg2d.TimerHandlerFn(func(t rpg2d.Timer, w rpg2d.TimerWorld) {
+				w.Insert(respawned)
+			}),
+
+			"despawn": rpg2d.TimerHandlerFn(func(t rpg2d.Timer, w rpg2d.TimerWorld) {
+				for _, e := range w.QueryBounds(bounds) {
+					w.Remove(e)
+				}
+			}),
+
+			"repeat": rpg2d.TimerHandlerFn(func(t rpg2d.Timer, w rpg2d.TimerWorld) {
+				repeated = append(repeated, w.Now())
+				w.Schedule(w.Now()+stime.Time(t.Data.(int)), t.Handler, t.Data)
+			}),
+		},
+
+		UpdatePhaseHandler: quad.UpdatePhaseHandlerFn(func(e entity.Entity, now stime.Time) entity.Entity {
+			if e.Id() == respawned.Id() {
+				updated = append(updated, now)
+			}
+			return e
+		}),
+		InputPhaseHandler:  mockInputPhase{},
+		NarrowPhaseHandler: mockNarrowPhase{},
+	}
+
+	c.Specify("a simulation with timers", func() {
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+		defer rs.Halt()
+
+		c.Specify("will fire a timer before the update phase of its tick", func() {
+			_, err := rs.Schedule(3, "respawn", nil)
+			c.Assume(err, IsNil)
+
+			c.Assume(ticker.Step(2), Equals, 2)
+			c.Expect(len(updated), Equals, 0)
+
+			c.Assume(ticker.Step(1), Equals, 1)
+			c.Expect(updated, ContainsExactly, []stime.Time{3})
+
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{respawned})
+			c.Expect(len(snapshot.Timers), Equals, 0)
+		})
+
+		c.Specify("will fire a timer that can remove entities", func() {
+			_, err := rs.Schedule(1, "respawn", nil)
+			c.Assume(err, IsNil)
+			_, err = rs.Schedule(2, "despawn", nil)
+			c.Assume(err, IsNil)
+
+			c.Assume(ticker.Step(2), Equals, 2)
+
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Entities, ContainsExactly, []entity.Entity{
+				entity.Removed{Entity: respawned, RemovedAt: 2},
+			})
+		})
+
+		c.Specify("will fire a timer further in the future than the wheel", func() {
+			_, err := rs.Schedule(300, "respawn", nil)
+			c.Assume(err, IsNil)
+
+			c.Assume(ticker.Step(299), Equals, 299)
+			c.Expect(len(updated), Equals, 0)
+
+			c.Assume(ticker.Step(1), Equals, 1)
+			c.Expect(updated, ContainsExactly, []stime.Time{300})
+		})
+
+		c.Specify("will fire timers scheduled by a handler", func() {
+			_, err := rs.Schedule(2, "repeat", 3)
+			c.Assume(err, IsNil)
+
+			c.Assume(ticker.Step(9), Equals, 9)
+			c.Expect(repeated, ContainsExactly, []stime.Time{2, 5, 8})
+		})
+
+		c.Specify("will not fire a cancelled timer", func() {
+			id, err := rs.Schedule(2, "respawn", nil)
+			c.Assume(err, IsNil)
+			c.Expect(rs.CancelTimer(id), IsNil)
+
+			c.Assume(ticker.Step(3), Equals, 3)
+			c.Expect(len(updated), Equals, 0)
+
+			c.Expect(rs.CancelTimer(id), Equals, rpg2d.ErrTimerNotScheduled)
+		})
+
+		c.Specify("will not schedule a timer without a handler", func() {
+			_, err := rs.Schedule(2, "sunrise", nil)
+			c.Expect(err, Equals, rpg2d.ErrUnknownTimerHandler)
+
+			_, err = rs.Schedule(2, "", nil)
+			c.Expect(err, Equals, rpg2d.ErrUnknownTimerHandler)
+		})
+
+		c.Specify("will include pending timers in a snapshot", func() {
+			_, err := rs.Schedule(5, "respawn", nil)
+			c.Assume(err, IsNil)
+			_, err = rs.Schedule(4, "repeat", 10)
+			c.Assume(err, IsNil)
+
+			c.Assume(ticker.Step(2), Equals, 2)
+
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Timers, ContainsExactly, []rpg2d.Timer{
+				{Id: 2, At: 4, Handler: "repeat", Data: 10},
+				{Id: 1, At: 5, Handler: "respawn"},
+			})
+
+			c.Specify("that will fire after being restored", func() {
+				buf := bytes.NewBuffer(nil)
+				c.Assume(snapshot.Encode(buf), IsNil)
+
+				snapshot, err := rpg2d.DecodeWorldSnapshot(buf)
+				c.Assume(err, IsNil)
+
+				_, err = rs.Halt()
+				c.Assume(err, IsNil)
+
+				ticker = rpg2d.NewManualTicker(time.Time{})
+				def.TickSource = ticker
+				def.QuadTree = newQuad()
+
+				rs, err := def.BeginFrom(snapshot)
+				c.Assume(err, IsNil)
+				defer rs.Halt()
+
+				c.Assume(ticker.Step(3), Equals, 3)
+				c.Expect(updated, ContainsExactly, []stime.Time{5})
+				c.Expect(repeated, ContainsExactly, []stime.Time{4})
+
+				// Ids continue from the restored timers
+				id, err := rs.Schedule(10, "respawn", nil)
+				c.Assume(err, IsNil)
+				c.Expect(id, Equals, rpg2d.TimerId(4))
+			})
+		})
+	})
+
+	c.Specify("a simulation will not begin with a timer without a handler", func() {
+		def.Timers = []rpg2d.Timer{{Id: 1, At: 2, Handler: "sunrise"}}
+		_, err := def.Begin()
+		c.Expect(errors.Is(err, rpg2d.ErrUnknownTimerHandler), IsTrue)
+	})
+
+	c.Specify("a simulation will not begin with 2 timers with the same id", func() {
+		def.Timers = []rpg2d.Timer{
+			{Id: 1, At: 2, Handler: "respawn"},
+			{Id: 1, At: 3, Handler: "respawn"},
+		}
+		_, err := def.Begin()
+		c.Expect(errors.Is(err, rpg2d.ErrDuplicateTimerId), IsTrue)
+	})
+
+	c.Specify("a simulation that begins with timers", func() {
+		def.Now = 2
+		def.Timers = []rpg2d.Timer{
+			{At: 0, Handler: "respawn"},
+			{Id: 1, At: 4, Handler: "repeat", Data: 10},
+		}
+
+		rs, err := def.Begin()
+		c.Assume(err, IsNil)
+		defer rs.Halt()
+
+		c.Specify("will assign ids and fire the timers in the past on the first tick", func() {
+			snapshot, err := rs.Snapshot()
+			c.Assume(err, IsNil)
+			c.Expect(snapshot.Timers, ContainsExactly, []rpg2d.Timer{
+				{Id: 2, At: 3, Handler: "respawn"},
+				{Id: 1, At: 4, Handler: "repeat", Data: 10},
+			})
+
+			c.Assume(ticker.Step(2), Equals, 2)
+			c.Expect(updated, ContainsExactly, []stime.Time{3, 4})
+			c.Expect(repeated, ContainsExactly, []stime.Time{4})
+		})
+	})
+}
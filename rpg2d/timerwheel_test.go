@@ -0,0 +1,56 @@
+package rpg2d
+
+import (
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func DescribeTimerWheel(c gospec.Context) {
+	w := newTimerWheel()
+
+	ids := func(timers []Timer) []TimerId {
+		ids := make([]TimerId, 0, len(timers))
+		for _, t := range timers {
+			ids = append(ids, t.Id)
+		}
+		return ids
+	}
+
+	c.Specify("a timer wheel", func() {
+		c.Specify("will expire the timers of every tick after the last", func() {
+			w.schedule(0, 5, "a", nil)
+			w.schedule(0, 2, "b", nil)
+			w.schedule(0, 3, "c", nil)
+			w.schedule(0, 7, "d", nil)
+
+			c.Expect(ids(w.expire(1, 5)), ContainsInOrder, []TimerId{2, 3, 1})
+			c.Expect(ids(w.timers()), ContainsInOrder, []TimerId{4})
+		})
+
+		c.Specify("will expire the timers of more ticks than the wheel has slots", func() {
+			w.schedule(0, 10, "a", nil)
+			w.schedule(0, 300, "b", nil)
+			w.schedule(0, 600, "c", nil)
+
+			c.Expect(ids(w.expire(0, 400)), ContainsInOrder, []TimerId{1, 2})
+			c.Expect(ids(w.timers()), ContainsInOrder, []TimerId{3})
+		})
+
+		c.Specify("will assign an id to a timer without one", func() {
+			w.addAll(2, []Timer{
+				{At: 5, Handler: "a"},
+				{Id: 1, At: 1, Handler: "b"},
+				{At: 4, Handler: "c"},
+			})
+
+			c.Expect(w.timers(), ContainsInOrder, []Timer{
+				{Id: 1, At: 3, Handler: "b"},
+				{Id: 3, At: 4, Handler: "c"},
+				{Id: 2, At: 5, Handler: "a"},
+			})
+
+			c.Expect(w.schedule(2, 3, "d", nil), Equals, TimerId(4))
+			c.Expect(ids(w.expire(2, 3)), ContainsInOrder, []TimerId{1, 4})
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package rpg2d
+
+import (
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+)
+
+// An Actor that implements StateDiffWriter will receive
+// a WorldStateDiff every tick after the initial state
+// when the simulation is managing the actor's view.
+type StateDiffWriter interface {
+	WriteStateDiff(WorldStateDiff)
+}
+
+// An actorView remembers the last state that was written to
+// an actor so the next state can be culled to the area around
+// the actor's entity and written as a diff. It is only used
+// by the go routine writing state to the actor, the actor's
+// entity is read by the game loop and queued with each state.
+type actorView struct {
+	radius int
+
+	last    WorldState
+	hasLast bool
+}
+
+func newActorView(radius int) *actorView {
+	if radius <= 0 {
+		return nil
+	}
+
+	return &actorView{radius: radius}
+}
+
+// Returns the bounds visible to the actor's entity.
+func (v actorView) boundsFor(id entity.Id, cell coord.Cell, s WorldState) coord.Bounds {
+	var bounds coord.Bounds
+	var found bool
+
+	for _, e := range s.Entities {
+		if e.EntityId() == id {
+			bounds, found = e.Bounds(), true
+			break
+		}
+	}
+
+	if !found {
+		bounds = coord.Bounds{TopL: cell, BotR: cell}
+	}
+
+	bounds, err := bounds.Expand(v.radius).Intersection(s.Bounds)
+	if err != nil {
+		return s.Bounds
+	}
+
+	return bounds
+}
+
+func (v *actorView) write(a Actor, s queuedState) {
+	bounds := v.boundsFor(s.entity, s.cell, s.state)
+
+	if !v.hasLast {
+		v.last, v.hasLast = s.state.CullForInitialState(bounds), true
+		a.WriteState(v.last)
+		return
+	}
+
+	next := s.state.Cull(bounds)
+
+	if w, ok := a.(StateDiffWriter); ok {
+		w.WriteStateDiff(v.last.viewDiff(next))
+	} else {
+		a.WriteState(next)
+	}
+
+	v.last = next
+}
+
+// Returns the diff between 2 culled states. Unlike Diff, the
+// entities that have entered the view are included with
+// the changed and new entities and the entities that
+// have left the view are included with the removed entities.
+func (prev WorldState) viewDiff(next WorldState) WorldStateDiff {
+	diff := prev.Diff(next)
+
+	inPrev := make(map[entity.Id]bool, len(prev.Entities))
+	for _, e := range prev.Entities {
+		inPrev[e.EntityId()] = true
+	}
+
+	inNext := make(map[entity.Id]bool, len(next.Entities))
+	for _, e := range next.Entities {
+		inNext[e.EntityId()] = true
+	}
+
+	inDiff := make(map[entity.Id]bool, len(diff.Entities)+len(diff.Removed))
+	for _, e := range diff.Entities {
+		inDiff[e.EntityId()] = true
+	}
+	for _, e := range diff.Removed {
+		inDiff[e.EntityId()] = true
+	}
+
+	for _, e := range next.Entities {
+		if !inPrev[e.EntityId()] && !inDiff[e.EntityId()] {
+			diff.Entities = append(diff.Entities, e)
+		}
+	}
+
+	for _, e := range prev.Entities {
+		if !inNext[e.EntityId()] && !inDiff[e.EntityId()] {
+			diff.Removed = append(diff.Removed, e)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,133 @@
+package rpg2d_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d"
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/rpg2d/entity/entitytest"
+	"github.com/ghthor/filu/rpg2d/quad"
+	"github.com/ghthor/filu/sim/stime"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+// An actor that records the culled states it receives
+type viewActor struct {
+	id rpg2d.ActorId
+	entitytest.MockEntity
+
+	mu     sync.Mutex
+	states []rpg2d.WorldState
+}
+
+func (a *viewActor) Id() rpg2d.ActorId     { return a.id }
+func (a *viewActor) Entity() entity.Entity { return a.MockEntity }
+func (a *viewActor) WriteState(s rpg2d.WorldState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.states = append(a.states, s)
+}
+
+// An actor that records the diffs it receives
+type diffActor struct {
+	viewActor
+	diffs []rpg2d.WorldStateDiff
+}
+
+func (a *diffActor) WriteStateDiff(d rpg2d.WorldStateDiff) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.diffs = append(a.diffs, d)
+}
+
+func entityIds(states entity.StateSlice) []entity.Id {
+	ids := make([]entity.Id, 0, len(states))
+	for _, s := range states {
+		ids = append(ids, s.EntityId())
+	}
+	return ids
+}
+
+func DescribeActorViews(c gospec.Context) {
+	bounds := coord.Bounds{
+		TopL: coord.Cell{-8, 8},
+		BotR: coord.Cell{7, -7},
+	}
+
+	terrainMap, err := rpg2d.NewTerrainMap(bounds, string(rpg2d.TT_GRASS))
+	c.Assume(err, IsNil)
+
+	q, err := quad.New(bounds, 10, nil)
+	c.Assume(err, IsNil)
+
+	q = q.Insert(entitytest.MockEntity{EntityId: 2, EntityCell: coord.Cell{1, 1}})
+	q = q.Insert(entitytest.MockEntity{EntityId: 3, EntityCell: coord.Cell{5, 5}})
+
+	ticker := rpg2d.NewManualTicker(time.Time{})
+
+	def := rpg2d.SimulationDef{
+		FPS:        40,
+		TickSource: ticker,
+		ViewRadius: 2,
+
+		QuadTree:   q,
+		TerrainMap: terrainMap,
+
+		// Moves entity 3 into the actor's view on the 2nd tick
+		UpdatePhaseHandler: quad.UpdatePhaseHandlerFn(func(e entity.Entity, now stime.Time) entity.Entity {
+			if e.Id() == 3 && now == 2 {
+				return entitytest.MockEntity{EntityId: 3, EntityCell: coord.Cell{2, 2}}
+			}
+			return e
+		}),
+		InputPhaseHandler:  mockInputPhase{},
+		NarrowPhaseHandler: mockNarrowPhase{},
+	}
+
+	rs, err := def.Begin()
+	c.Assume(err, IsNil)
+
+	defer func() {
+		_, err := rs.Halt()
+		c.Assume(err, IsNil)
+	}()
+
+	c.Specify("an actor will receive an initial state culled to its view", func() {
+		a := &diffActor{viewActor: viewActor{id: 1, MockEntity: entitytest.MockEntity{EntityId: 1}}}
+		rs.ConnectActor(a)
+
+		c.Assume(ticker.Step(1), Equals, 1)
+		c.Assume(len(a.states), Equals, 1)
+
+		initial := a.states[0]
+		c.Expect(initial.Bounds, Equals, coord.Bounds{
+			TopL: coord.Cell{-2, 2},
+			BotR: coord.Cell{2, -2},
+		})
+		c.Expect(entityIds(initial.Entities), ContainsExactly, []entity.Id{1, 2})
+		c.Expect(initial.TerrainMap.Bounds, Equals, initial.Bounds)
+
+		c.Specify("and then diffs that include entities entering its view", func() {
+			c.Assume(ticker.Step(1), Equals, 1)
+
+			c.Expect(len(a.states), Equals, 1)
+			c.Assume(len(a.diffs), Equals, 1)
+			c.Expect(a.diffs[0].Time, Equals, stime.Time(2))
+			c.Expect(entityIds(a.diffs[0].Entities), ContainsExactly, []entity.Id{3})
+			c.Expect(len(a.diffs[0].Removed), Equals, 0)
+		})
+	})
+
+	c.Specify("an actor that doesn't accept diffs will receive culled states", func() {
+		a := &viewActor{id: 1, MockEntity: entitytest.MockEntity{EntityId: 1}}
+		rs.ConnectActor(a)
+
+		c.Assume(ticker.Step(2), Equals, 2)
+		c.Assume(len(a.states), Equals, 2)
+		c.Expect(entityIds(a.states[1].Entities), ContainsExactly, []entity.Id{1, 2, 3})
+	})
+}
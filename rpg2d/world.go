@@ -11,6 +11,9 @@ type World struct {
 	quadTree quad.Quad
 	terrain  TerrainMap
 
+	// Pending timers
+	timers *timerWheel
+
 	state WorldState
 }
 
@@ -21,6 +24,8 @@ func NewWorld(now stime.Time, quad quad.Quad, terrain TerrainMap) *World {
 		quadTree: quad,
 		terrain:  terrain,
 
+		timers: newTimerWheel(),
+
 		state: WorldState{
 			Entities:          make(entity.StateSlice, 0, defaultEntitiesSize),
 			EntitiesNew:       make(entity.StateSlice, 0, defaultEntitiesSize),
@@ -0,0 +1,246 @@
+package rpg2d
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ghthor/filu/rpg2d/coord"
+	"github.com/ghthor/filu/rpg2d/entity"
+	"github.com/ghthor/filu/sim/stime"
+)
+
+// A SlowActorPolicy decides what the simulation will do
+// with an actor that hasn't been able to keep up with
+// the states the simulation has been writing to it.
+type SlowActorPolicy int
+
+const (
+	// The newest state isn't written to the actor.
+	SlowActorSkip SlowActorPolicy = iota
+
+	// The oldest state waiting to be written to the actor
+	// is replaced so the actor will receive the newest state.
+	SlowActorCoalesce
+
+	// The actor is removed from the simulation.
+	SlowActorDisconnect
+)
+
+const defaultActorQueueSize = 1
+
+const defaultWriteStateDeadline = time.Second
+
+// ActorDropped is emitted when an actor
+// is disconnected for being too slow.
+type ActorDropped struct {
+	Actor Actor
+
+	// The time of the state the actor was unable to receive
+	At stime.Time
+}
+
+// A state waiting to be written to an actor. The written
+// channel is shared by every actor the simulation is waiting
+// for and is sent to once the state has been written or has
+// been discarded. It is nil if nothing is waiting for the state.
+type queuedState struct {
+	state   WorldState
+	written chan<- struct{}
+
+	// The final state written before the simulation halts
+	final bool
+
+	// The actor's entity when the state was calculated.
+	// Only set when the state is culled to the actor's view.
+	entity entity.Id
+	cell   coord.Cell
+}
+
+// An Actor that implements HaltListener will be
+// notified after the final state has been written
+// to it when the simulation is halting.
+type HaltListener interface {
+	SimulationHalting(at stime.Time)
+}
+
+// An actorWriter writes states to an actor on its own go
+// routine so an actor that blocks in WriteState will
+// not stall the simulation.
+type actorWriter struct {
+	actor Actor
+	queue chan queuedState
+	stop  chan struct{}
+
+	// The number of states that have been queued and
+	// haven't been written or discarded yet
+	pending int32
+
+	// Optional, culls the state to the actor's view
+	view *actorView
+}
+
+func newActorWriter(a Actor, queueSize int, view *actorView) *actorWriter {
+	if queueSize <= 0 {
+		queueSize = defaultActorQueueSize
+	}
+
+	w := &actorWriter{
+		actor: a,
+		queue: make(chan queuedState, queueSize),
+		stop:  make(chan struct{}),
+
+		view: view,
+	}
+
+	go w.run()
+
+	return w
+}
+
+func (w *actorWriter) run() {
+	for {
+		select {
+		case <-w.stop:
+			w.discard()
+			return
+
+		case s := <-w.queue:
+			if w.view != nil {
+				w.view.write(w.actor, s)
+			} else {
+				w.actor.WriteState(s.state)
+			}
+
+			if l, ok := w.actor.(HaltListener); ok && s.final {
+				l.SimulationHalting(s.state.Time)
+			}
+
+			w.done(s)
+		}
+	}
+}
+
+// Release every state waiting to be written
+func (w *actorWriter) discard() {
+	for {
+		select {
+		case s := <-w.queue:
+			w.done(s)
+		default:
+			return
+		}
+	}
+}
+
+// Called once the state has been written or discarded
+func (w *actorWriter) done(s queuedState) {
+	atomic.AddInt32(&w.pending, -1)
+	if s.written != nil {
+		s.written <- struct{}{}
+	}
+}
+
+// Returns true if the actor is still writing,
+// or has yet to write, a state it was sent.
+func (w *actorWriter) busy() bool {
+	return atomic.LoadInt32(&w.pending) > 0
+}
+
+// Returns a state to be queued for the actor. Must be called
+// by the game loop so the actor's entity isn't read while
+// the simulation is modifying it.
+func (w *actorWriter) queued(state WorldState, written chan<- struct{}) queuedState {
+	s := queuedState{state: state, written: written}
+
+	if w.view != nil {
+		e := w.actor.Entity()
+		s.entity, s.cell = e.Id(), e.Cell()
+	}
+
+	return s
+}
+
+// Add the state to the queue. Returns false if
+// the queue is full and the policy is to disconnect.
+func (w *actorWriter) enqueue(s queuedState, policy SlowActorPolicy) bool {
+	atomic.AddInt32(&w.pending, 1)
+
+	select {
+	case w.queue <- s:
+		return true
+	default:
+	}
+
+	switch policy {
+	case SlowActorCoalesce:
+		// Replace the oldest state. The writer may have taken
+		// it off the queue in the meantime, which also makes
+		// room for the newest state.
+		select {
+		case old := <-w.queue:
+			w.done(old)
+		default:
+		}
+
+		select {
+		case w.queue <- s:
+			return true
+		default:
+			w.done(s)
+			return true
+		}
+
+	case SlowActorDisconnect:
+		w.done(s)
+		return false
+
+	default:
+		w.done(s)
+		return true
+	}
+}
+
+// Must only be called once, by the simulation's game loop.
+func (w *actorWriter) close() {
+	close(w.stop)
+}
+
+// Wait for n states to be written until the deadline
+// has passed. A negative deadline will wait forever. The
+// written channel must be buffered so the actor writers
+// that finish after the deadline won't block.
+func waitUntil(written <-chan struct{}, n int, deadline time.Duration) {
+	var timeout <-chan time.Time
+	if deadline >= 0 {
+		timer := time.NewTimer(deadline)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for ; n > 0; n-- {
+		select {
+		case <-written:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// Returns a copy of the state that doesn't share any
+// entity slices with it. The terrain map isn't modified
+// by the simulation so it is shared.
+func (s WorldState) copyEntities() WorldState {
+	copySlice := func(states entity.StateSlice) entity.StateSlice {
+		c := make(entity.StateSlice, len(states))
+		copy(c, states)
+		return c
+	}
+
+	s.Entities = copySlice(s.Entities)
+	s.EntitiesRemoved = copySlice(s.EntitiesRemoved)
+	s.EntitiesNew = copySlice(s.EntitiesNew)
+	s.EntitiesChanged = copySlice(s.EntitiesChanged)
+	s.EntitiesUnchanged = copySlice(s.EntitiesUnchanged)
+
+	return s
+}
@@ -0,0 +1,582 @@
+package ssim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// An EventCodec is used by a file backed event log to
+// serialize Event's to and from its segment files.
+type EventCodec interface {
+	Marshal(Event) ([]byte, error)
+	Unmarshal([]byte) (Event, error)
+}
+
+type gobCodec struct{}
+
+// GobCodec returns an EventCodec implemented with encoding/gob.
+// Every concrete Event type written to the log must be
+// registered with gob.Register.
+func GobCodec() EventCodec { return gobCodec{} }
+
+func (gobCodec) Marshal(e Event) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	err := gob.NewEncoder(buf).Encode(&e)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte) (Event, error) {
+	var e Event
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e)
+	return e, err
+}
+
+// A SyncPolicy decides when a file backed event log
+// will fsync its active segment file.
+type SyncPolicy int
+
+const (
+	// The segment file is synced when it is rotated or closed.
+	SyncOnRotate SyncPolicy = iota
+	// The segment file is synced after every Event is written.
+	SyncEveryWrite
+	// The segment file is never synced by the log.
+	SyncNever
+)
+
+// A FileEventLog is an EventStream that persists every Event
+// it accepts into a directory of append only segment files.
+type FileEventLog interface {
+	EventLog
+	CancelableEventEmitter
+
+	// Replay will write every persisted Event, in the order
+	// they were accepted, to all of the subscribers.
+	Replay() error
+
+	// Err returns the first error encountered while persisting
+	// an Event. Once an error has occurred the log will ignore
+	// any further writes.
+	Err() error
+
+	// Close will sync and close the active segment file.
+	Close() error
+}
+
+var ErrCorruptSegment = errors.New("event log segment is corrupt")
+
+const (
+	segmentExt = ".seg"
+
+	// length + checksum + time accepted
+	recordHeaderSize = 4 + 4 + 8
+	maxRecordSize    = 1 << 26
+
+	defaultSegmentSize = 1 << 24
+)
+
+type segment struct {
+	base int64
+	path string
+}
+
+func segmentPath(dir string, base int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+type fileEventLog struct {
+	dir      string
+	segments []segment
+
+	active     *os.File
+	activeSize int64
+
+	// The offset the next Event will be written at
+	next int64
+
+	subs []*fileSubscription
+	err  error
+
+	now            func() time.Time
+	codec          EventCodec
+	sync           SyncPolicy
+	maxSegmentSize int64
+}
+
+type FileEventLogOption func(*fileEventLog)
+
+func FileNowProvider(now func() time.Time) FileEventLogOption {
+	return func(l *fileEventLog) {
+		l.now = now
+	}
+}
+
+func FileCodec(codec EventCodec) FileEventLogOption {
+	return func(l *fileEventLog) {
+		l.codec = codec
+	}
+}
+
+func FileSyncPolicy(policy SyncPolicy) FileEventLogOption {
+	return func(l *fileEventLog) {
+		l.sync = policy
+	}
+}
+
+// FileSegmentSize sets the size in bytes a segment file may
+// grow to before the log will rotate to a new segment file.
+func FileSegmentSize(size int64) FileEventLogOption {
+	return func(l *fileEventLog) {
+		l.maxSegmentSize = size
+	}
+}
+
+// OpenFileEventLog will open, or create, an event log in dir.
+// If the log already contains events it is ready to be
+// replayed and new events will be appended after them.
+// A partially written event at the end of the log, from
+// a process that exited mid write, will be truncated.
+func OpenFileEventLog(dir string, options ...FileEventLogOption) (FileEventLog, error) {
+	l := &fileEventLog{
+		dir:  dir,
+		subs: make([]*fileSubscription, 0, 10),
+
+		now:            time.Now,
+		codec:          GobCodec(),
+		sync:           SyncOnRotate,
+		maxSegmentSize: defaultSegmentSize,
+	}
+
+	for _, o := range options {
+		o(l)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	segments, err := readSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segments) == 0 {
+		return l, l.createSegment(0)
+	}
+
+	l.segments = segments
+	last := segments[len(segments)-1]
+
+	count, size, err := recoverSegment(last.path)
+	if err != nil {
+		return nil, err
+	}
+
+	l.active, err = os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	l.activeSize = size
+	l.next = last.base + count
+
+	return l, nil
+}
+
+func readSegments(dir string) ([]segment, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, 0, len(paths))
+	for _, path := range paths {
+		var base int64
+		_, err := fmt.Sscanf(filepath.Base(path), "%d"+segmentExt, &base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid segment file name %s: %v", path, err)
+		}
+		segments = append(segments, segment{base, path})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].base < segments[j].base
+	})
+
+	return segments, nil
+}
+
+// Counts the valid records in a segment file and truncates
+// any trailing bytes that do not form a complete record.
+func recoverSegment(path string) (count, size int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		_, _, n, err := readRecord(r)
+		if err != nil {
+			break
+		}
+		count++
+		size += n
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	return count, size, os.Truncate(path, size)
+}
+
+func (l *fileEventLog) createSegment(base int64) error {
+	path := segmentPath(l.dir, base)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	l.segments = append(l.segments, segment{base, path})
+	l.active = f
+	l.activeSize = 0
+	return nil
+}
+
+func (l *fileEventLog) rotate() error {
+	if l.sync != SyncNever {
+		if err := l.active.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+
+	return l.createSegment(l.next)
+}
+
+func (l *fileEventLog) append(e Event, acceptedAt time.Time) error {
+	data, err := l.codec.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	record := encodeRecord(data, acceptedAt)
+
+	if l.activeSize > 0 && l.activeSize+int64(len(record)) > l.maxSegmentSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.active.Write(record)
+	l.activeSize += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if l.sync == SyncEveryWrite {
+		if err := l.active.Sync(); err != nil {
+			return err
+		}
+	}
+
+	l.next++
+	return nil
+}
+
+// Write will persist the event before it is written to
+// the subscribers. If the event can't be persisted it
+// will NOT be written to the subscribers.
+func (l *fileEventLog) Write(e Event) {
+	if l.err != nil {
+		return
+	}
+
+	now := l.now()
+	e = e.AcceptAt(now)
+
+	if err := l.append(e, now); err != nil {
+		l.err = err
+		return
+	}
+
+	l.writeToSubscribers(e)
+}
+
+func (l *fileEventLog) writeToSubscribers(e Event) {
+	for _, s := range l.subs {
+		s.w.Write(e)
+	}
+}
+
+func (l *fileEventLog) Subscribe(w EventWriter) {
+	l.SubscribeCancelable(w)
+}
+
+// The Subscription must be canceled from the go routine
+// that is writing to the log.
+func (l *fileEventLog) SubscribeCancelable(w EventWriter) Subscription {
+	s := &fileSubscription{
+		log:  l,
+		w:    w,
+		done: make(chan struct{}),
+	}
+	l.subs = append(l.subs, s)
+	return s
+}
+
+type fileSubscription struct {
+	log  *fileEventLog
+	w    EventWriter
+	done chan struct{}
+}
+
+func (s *fileSubscription) Cancel() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	// Cancel may be called by a subscriber during Write
+	// so the subscribers slice can't be modified in place.
+	subs := make([]*fileSubscription, 0, cap(s.log.subs))
+	for _, sub := range s.log.subs {
+		if sub != s {
+			subs = append(subs, sub)
+		}
+	}
+	s.log.subs = subs
+
+	close(s.done)
+}
+
+func (s *fileSubscription) Done() <-chan struct{} { return s.done }
+
+func (l *fileEventLog) Replay() error {
+	r := l.ReadFrom(0)
+	defer r.Close()
+
+	for {
+		_, e, err := r.Next()
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+
+		l.writeToSubscribers(e)
+	}
+}
+
+func (l *fileEventLog) ReadFrom(offset Offset) EventReader {
+	if offset < 0 {
+		offset = 0
+	}
+
+	return &fileEventReader{log: l, next: offset}
+}
+
+func (l *fileEventLog) OffsetAt(t time.Time) (Offset, error) {
+	for _, seg := range l.segments {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return 0, err
+		}
+
+		r := bufio.NewReader(f)
+		for offset := seg.base; offset < l.next; offset++ {
+			acceptedAt, _, _, err := readRecord(r)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				f.Close()
+				return 0, err
+			}
+
+			if !acceptedAt.Before(t) {
+				f.Close()
+				return Offset(offset), nil
+			}
+		}
+
+		if err := f.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	return Offset(l.next), nil
+}
+
+func (l *fileEventLog) Err() error { return l.err }
+
+func (l *fileEventLog) Close() error {
+	if l.sync != SyncNever {
+		if err := l.active.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+
+	return l.err
+}
+
+type fileEventReader struct {
+	log  *fileEventLog
+	next Offset
+
+	// The segment that is open for reading and
+	// the offset of the next record in it.
+	seg int
+	f   *os.File
+	r   *bufio.Reader
+	pos Offset
+}
+
+func (r *fileEventReader) open(seg int) error {
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(r.log.segments[seg].path)
+	if err != nil {
+		r.f = nil
+		return err
+	}
+
+	r.seg = seg
+	r.f = f
+	r.r = bufio.NewReader(f)
+	r.pos = Offset(r.log.segments[seg].base)
+	return nil
+}
+
+func (r *fileEventReader) Next() (Offset, Event, error) {
+	segments := r.log.segments
+	if int64(r.next) >= r.log.next {
+		return r.next, nil, io.EOF
+	}
+
+	switch {
+	case r.f == nil || r.pos > r.next:
+		seg := sort.Search(len(segments), func(i int) bool {
+			return Offset(segments[i].base) > r.next
+		}) - 1
+
+		if err := r.open(seg); err != nil {
+			return r.next, nil, err
+		}
+
+	case r.seg+1 < len(segments) && Offset(segments[r.seg+1].base) <= r.next:
+		if err := r.open(r.seg + 1); err != nil {
+			return r.next, nil, err
+		}
+	}
+
+	for ; r.pos < r.next; r.pos++ {
+		if _, _, _, err := readRecord(r.r); err != nil {
+			return r.next, nil, r.corrupt(err)
+		}
+	}
+
+	_, data, _, err := readRecord(r.r)
+	if err != nil {
+		return r.next, nil, r.corrupt(err)
+	}
+
+	e, err := r.log.codec.Unmarshal(data)
+	if err != nil {
+		return r.next, nil, err
+	}
+
+	offset := r.next
+	r.pos++
+	r.next++
+	return offset, e, nil
+}
+
+// The log said the record exists so reaching the
+// end of the segment is a corruption of the segment.
+func (r *fileEventReader) corrupt(err error) error {
+	if err == io.EOF {
+		return ErrCorruptSegment
+	}
+	return err
+}
+
+func (r *fileEventReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func encodeRecord(data []byte, acceptedAt time.Time) []byte {
+	record := make([]byte, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint64(record[8:16], uint64(acceptedAt.UnixNano()))
+	copy(record[recordHeaderSize:], data)
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[8:]))
+	return record
+}
+
+// Reads a single record and returns io.EOF only if the reader
+// was positioned at the end of the last complete record.
+func readRecord(r io.Reader) (acceptedAt time.Time, data []byte, n int64, err error) {
+	var header [recordHeaderSize]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorruptSegment
+		}
+		return
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		err = ErrCorruptSegment
+		return
+	}
+
+	data = make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		err = ErrCorruptSegment
+		return
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[8:])
+	crc.Write(data)
+	if crc.Sum32() != binary.BigEndian.Uint32(header[4:8]) {
+		err = ErrCorruptSegment
+		return
+	}
+
+	acceptedAt = time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+	return acceptedAt, data, recordHeaderSize + int64(size), nil
+}
@@ -0,0 +1,145 @@
+package ssim_test
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ghthor/filu/ssim"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+// An event that is friendly to encoding/gob
+type persistedEvent struct {
+	Actor    ssim.ActorID
+	Accepted time.Time
+}
+
+func init() {
+	gob.Register(persistedEvent{})
+}
+
+func (e persistedEvent) Source() ssim.ActorID { return e.Actor }
+func (e persistedEvent) IssuedAt() time.Time  { return time.Time{} }
+func (e persistedEvent) AcceptAt(t time.Time) ssim.Event {
+	e.Accepted = t
+	return e
+}
+
+type eventRecorder struct {
+	events []ssim.Event
+}
+
+func (w *eventRecorder) Write(e ssim.Event) {
+	w.events = append(w.events, e)
+}
+
+func tempDir(c gospec.Context) string {
+	dir, err := ioutil.TempDir("", "ssim_file_log")
+	c.Assume(err, IsNil)
+	return dir
+}
+
+func removeDir(dir string) { os.RemoveAll(dir) }
+
+func DescribeFileEventLog(c gospec.Context) {
+	c.Specify("a file event log", func() {
+		dir := tempDir(c)
+		defer removeDir(dir)
+
+		now, err := time.Parse(time.RFC3339, "2015-04-01T00:00:00Z")
+		c.Assume(err, IsNil)
+
+		nowProvider := ssim.FileNowProvider(func() time.Time {
+			return now
+		})
+
+		l, err := ssim.OpenFileEventLog(dir, nowProvider)
+		c.Assume(err, IsNil)
+
+		out := &eventRecorder{}
+		l.Subscribe(out)
+
+		c.Specify("will set the time received on the event", func() {
+			l.Write(persistedEvent{Actor: 1})
+			c.Expect(out.events, ContainsExactly, []ssim.Event{
+				persistedEvent{Actor: 1, Accepted: now},
+			})
+			c.Expect(l.Close(), IsNil)
+		})
+
+		c.Specify("will rotate segment files", func() {
+			c.Assume(l.Close(), IsNil)
+
+			l, err = ssim.OpenFileEventLog(dir, nowProvider, ssim.FileSegmentSize(1))
+			c.Assume(err, IsNil)
+
+			for i := 0; i < 3; i++ {
+				l.Write(persistedEvent{Actor: ssim.ActorID(i)})
+			}
+			c.Assume(l.Close(), IsNil)
+
+			segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+			c.Assume(err, IsNil)
+			c.Expect(len(segments), Equals, 3)
+		})
+
+		c.Specify("can be reopened and replayed", func() {
+			l.Write(persistedEvent{Actor: 1})
+			l.Write(persistedEvent{Actor: 2})
+			c.Assume(l.Close(), IsNil)
+
+			l, err := ssim.OpenFileEventLog(dir, nowProvider, ssim.FileSegmentSize(1))
+			c.Assume(err, IsNil)
+			defer l.Close()
+
+			replayed := &eventRecorder{}
+			l.Subscribe(replayed)
+
+			l.Write(persistedEvent{Actor: 3})
+			replayed.events = nil
+
+			c.Expect(l.Replay(), IsNil)
+			c.Expect(replayed.events, ContainsInOrder, []ssim.Event{
+				persistedEvent{Actor: 1, Accepted: now},
+				persistedEvent{Actor: 2, Accepted: now},
+				persistedEvent{Actor: 3, Accepted: now},
+			})
+		})
+
+		c.Specify("will truncate a partially written event", func() {
+			l.Write(persistedEvent{Actor: 1})
+			c.Assume(l.Close(), IsNil)
+
+			segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+			c.Assume(err, IsNil)
+			c.Assume(len(segments), Equals, 1)
+
+			f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+			c.Assume(err, IsNil)
+			_, err = f.Write([]byte{0, 0, 0})
+			c.Assume(err, IsNil)
+			c.Assume(f.Close(), IsNil)
+
+			l, err := ssim.OpenFileEventLog(dir, nowProvider)
+			c.Assume(err, IsNil)
+			defer l.Close()
+
+			replayed := &eventRecorder{}
+			l.Subscribe(replayed)
+
+			l.Write(persistedEvent{Actor: 2})
+			replayed.events = nil
+
+			c.Expect(l.Replay(), IsNil)
+			c.Expect(replayed.events, ContainsExactly, []ssim.Event{
+				persistedEvent{Actor: 1, Accepted: now},
+				persistedEvent{Actor: 2, Accepted: now},
+			})
+		})
+	})
+}
@@ -1,10 +1,173 @@
 package ssim
 
-import "time"
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An OverflowPolicy decides what a buffered event log
+// will do when a subscriber's buffer is full.
+type OverflowPolicy int
+
+const (
+	// Write will block until the subscriber has room in its buffer.
+	OverflowBlock OverflowPolicy = iota
+	// The oldest buffered Event will be dropped to make room.
+	OverflowDropOldest
+	// The subscriber will be disconnected from the log.
+	OverflowDisconnect
+)
+
+// SubscriberMetrics are the delivery statistics
+// of a single subscriber of an event log.
+type SubscriberMetrics struct {
+	Subscriber EventWriter
+
+	Delivered uint64
+	Dropped   uint64
+	Buffered  int
+
+	Disconnected bool
+}
+
+// A MemEventLog is the EventLog returned by NewMemEventLog.
+type MemEventLog interface {
+	EventLog
+	CancelableEventEmitter
+
+	// Flush blocks until every buffered Event has been
+	// written to, or dropped by, the subscribers.
+	Flush()
+
+	// Metrics returns the delivery statistics of the
+	// current and disconnected subscribers.
+	Metrics() []SubscriberMetrics
+
+	// Close will Flush and then stop the go routines
+	// delivering Event's to buffered subscribers.
+	Close()
+}
+
+type subscriber struct {
+	w EventWriter
+
+	// nil when the subscriber is written to by Write
+	buffer  chan Event
+	pending sync.WaitGroup
+
+	delivered, dropped uint64
+
+	disconnected bool
+	done         chan struct{}
+}
+
+func newSubscriber(w EventWriter, bufferSize int) *subscriber {
+	s := &subscriber{
+		w:    w,
+		done: make(chan struct{}),
+	}
+
+	if bufferSize > 0 {
+		s.buffer = make(chan Event, bufferSize)
+		go s.deliver()
+	}
+
+	return s
+}
+
+func (s *subscriber) deliver() {
+	for e := range s.buffer {
+		select {
+		case <-s.done:
+			// The subscriber has been disconnected so
+			// the rest of the buffered events are dropped
+			atomic.AddUint64(&s.dropped, 1)
+
+		default:
+			s.w.Write(e)
+			atomic.AddUint64(&s.delivered, 1)
+		}
+
+		s.pending.Done()
+	}
+}
+
+// Returns false if the subscriber must be disconnected.
+func (s *subscriber) write(e Event, policy OverflowPolicy) bool {
+	if s.buffer == nil {
+		s.w.Write(e)
+		atomic.AddUint64(&s.delivered, 1)
+		return true
+	}
+
+	s.pending.Add(1)
+
+	select {
+	case s.buffer <- e:
+		return true
+	default:
+	}
+
+	switch policy {
+	case OverflowBlock:
+		s.buffer <- e
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.buffer <- e:
+				return true
+			default:
+			}
+
+			select {
+			case <-s.buffer:
+				atomic.AddUint64(&s.dropped, 1)
+				s.pending.Done()
+			default:
+			}
+		}
+
+	case OverflowDisconnect:
+		atomic.AddUint64(&s.dropped, 1)
+		s.pending.Done()
+		return false
+	}
+
+	return true
+}
+
+// The events that are still buffered will be dropped. An event
+// that is being written to the subscriber will be delivered.
+func (s *subscriber) disconnect() {
+	s.disconnected = true
+	close(s.done)
+	if s.buffer != nil {
+		close(s.buffer)
+	}
+}
+
+func (s *subscriber) metrics() SubscriberMetrics {
+	return SubscriberMetrics{
+		Subscriber:   s.w,
+		Delivered:    atomic.LoadUint64(&s.delivered),
+		Dropped:      atomic.LoadUint64(&s.dropped),
+		Buffered:     len(s.buffer),
+		Disconnected: s.disconnected,
+	}
+}
 
 type memEventLog struct {
-	events []Event
-	subs   []EventWriter
+	events   []Event
+	accepted []time.Time
+
+	subs         []*subscriber
+	disconnected []*subscriber
+
+	bufferSize int
+	overflow   OverflowPolicy
 
 	now func() time.Time
 }
@@ -17,11 +180,27 @@ func NowProvider(now func() time.Time) MemEventLogOption {
 	}
 }
 
-func NewMemEventLog(options ...MemEventLogOption) EventStream {
+// BufferedSubscribers will give each subscriber a buffer of `size`
+// Event's and a go routine that writes them to the subscriber.
+// This prevents a slow subscriber from stalling Write. The
+// policy decides what happens when a subscriber's buffer is full.
+// Every subscriber will receive Event's in the order they
+// were written to the log.
+func BufferedSubscribers(size int, policy OverflowPolicy) MemEventLogOption {
+	return func(l *memEventLog) {
+		l.bufferSize = size
+		l.overflow = policy
+	}
+}
+
+func NewMemEventLog(options ...MemEventLogOption) MemEventLog {
 	l := &memEventLog{
 		// TODO add a package option to adjust default capacities
-		events: make([]Event, 0, 1024),
-		subs:   make([]EventWriter, 0, 10),
+		events:   make([]Event, 0, 1024),
+		accepted: make([]time.Time, 0, 1024),
+		subs:     make([]*subscriber, 0, 10),
+
+		now: time.Now,
 	}
 
 	for _, o := range options {
@@ -32,16 +211,133 @@ func NewMemEventLog(options ...MemEventLogOption) EventStream {
 }
 
 func (l *memEventLog) Write(e Event) {
-	e = e.AcceptAt(l.now())
+	now := l.now()
+	e = e.AcceptAt(now)
 
 	l.events = append(l.events, e)
+	l.accepted = append(l.accepted, now)
 
-	// TODO add concurrent writes using a waitgroup
 	for _, s := range l.subs {
-		s.Write(e)
+		// A subscriber may have been canceled by
+		// another subscriber during this Write
+		if s.disconnected {
+			continue
+		}
+
+		if !s.write(e, l.overflow) {
+			l.disconnect(s)
+		}
 	}
 }
 
+// Removes the subscriber from the log and keeps it with the
+// disconnected subscribers for Flush and Metrics. A subscriber
+// may be disconnected during Write so the subscribers slice
+// can't be modified in place.
+func (l *memEventLog) disconnect(s *subscriber) {
+	subs := make([]*subscriber, 0, cap(l.subs))
+	for _, sub := range l.subs {
+		if sub != s {
+			subs = append(subs, sub)
+		}
+	}
+	l.subs = subs
+
+	s.disconnect()
+	l.disconnected = append(l.disconnected, s)
+}
+
 func (l *memEventLog) Subscribe(w EventWriter) {
-	l.subs = append(l.subs, w)
+	l.subs = append(l.subs, newSubscriber(w, l.bufferSize))
 }
+
+// The Subscription must be canceled from the go routine
+// that is writing to the log.
+func (l *memEventLog) SubscribeCancelable(w EventWriter) Subscription {
+	s := newSubscriber(w, l.bufferSize)
+	l.subs = append(l.subs, s)
+	return memSubscription{l, s}
+}
+
+type memSubscription struct {
+	log *memEventLog
+	sub *subscriber
+}
+
+func (s memSubscription) Cancel() {
+	if s.sub.disconnected {
+		return
+	}
+
+	s.log.disconnect(s.sub)
+}
+
+func (s memSubscription) Done() <-chan struct{} { return s.sub.done }
+
+func (l *memEventLog) Flush() {
+	for _, s := range l.subs {
+		s.pending.Wait()
+	}
+
+	for _, s := range l.disconnected {
+		s.pending.Wait()
+	}
+}
+
+func (l *memEventLog) Metrics() []SubscriberMetrics {
+	metrics := make([]SubscriberMetrics, 0, len(l.subs)+len(l.disconnected))
+	for _, s := range l.subs {
+		metrics = append(metrics, s.metrics())
+	}
+
+	for _, s := range l.disconnected {
+		metrics = append(metrics, s.metrics())
+	}
+
+	return metrics
+}
+
+func (l *memEventLog) Close() {
+	l.Flush()
+
+	for _, s := range l.subs {
+		s.disconnect()
+		l.disconnected = append(l.disconnected, s)
+	}
+
+	l.subs = l.subs[:0]
+}
+
+func (l *memEventLog) ReadFrom(offset Offset) EventReader {
+	return &memEventReader{l, offset}
+}
+
+func (l *memEventLog) OffsetAt(t time.Time) (Offset, error) {
+	for i, accepted := range l.accepted {
+		if !accepted.Before(t) {
+			return Offset(i), nil
+		}
+	}
+	return Offset(len(l.accepted)), nil
+}
+
+type memEventReader struct {
+	log  *memEventLog
+	next Offset
+}
+
+func (r *memEventReader) Next() (Offset, Event, error) {
+	if r.next < 0 {
+		r.next = 0
+	}
+
+	if int(r.next) >= len(r.log.events) {
+		return r.next, nil, io.EOF
+	}
+
+	offset := r.next
+	r.next++
+	return offset, r.log.events[offset], nil
+}
+
+func (r *memEventReader) Close() error { return nil }
@@ -1,6 +1,7 @@
 package ssim_test
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/ghthor/filu/ssim"
@@ -70,5 +71,206 @@ func DescribeMemEventLog(c gospec.Context) {
 				}
 			})
 		})
+
+		c.Specify("can unsubscribe a subscriber", func() {
+			l := ssim.NewMemEventLog(ssim.NowProvider(func() time.Time {
+				return now
+			}))
+
+			out := &eventRecorder{}
+			sub := l.SubscribeCancelable(out)
+
+			l.Write(mockEvent{})
+			sub.Cancel()
+			l.Write(mockEvent{})
+
+			c.Expect(len(out.events), Equals, 1)
+
+			_, isOpen := <-sub.Done()
+			c.Expect(isOpen, IsFalse)
+
+			c.Specify("from within its Write", func() {
+				others := []*eventRecorder{{}, {}}
+				var sub ssim.Subscription
+				sub = l.SubscribeCancelable(writerFn(func(ssim.Event) {
+					sub.Cancel()
+				}))
+				for _, w := range others {
+					l.Subscribe(w)
+				}
+
+				l.Write(mockEvent{})
+				l.Write(mockEvent{})
+				for _, w := range others {
+					c.Expect(len(w.events), Equals, 2)
+				}
+			})
+		})
+	})
+}
+
+type writerFn func(ssim.Event)
+
+func (fn writerFn) Write(e ssim.Event) { fn(e) }
+
+// Blocks every Write until the gate is opened
+type gatedEventWriter struct {
+	gate chan struct{}
+
+	// Signaled every time Write is called
+	writing chan struct{}
+
+	eventRecorder
+}
+
+func newGatedEventWriter() *gatedEventWriter {
+	return &gatedEventWriter{
+		gate:    make(chan struct{}),
+		writing: make(chan struct{}, 10),
+	}
+}
+
+func (w *gatedEventWriter) Write(e ssim.Event) {
+	w.writing <- struct{}{}
+	<-w.gate
+	w.eventRecorder.Write(e)
+}
+
+func (w *gatedEventWriter) open() { close(w.gate) }
+
+func DescribeBufferedMemEventLog(c gospec.Context) {
+	c.Specify("a buffered event log", func() {
+		now := time.Now()
+		nowProvider := ssim.NowProvider(func() time.Time {
+			return now
+		})
+
+		event := func(id int) ssim.Event {
+			return persistedEvent{Actor: ssim.ActorID(id), Accepted: now}
+		}
+
+		newLog := func(policy ssim.OverflowPolicy) (ssim.MemEventLog, *gatedEventWriter) {
+			l := ssim.NewMemEventLog(nowProvider, ssim.BufferedSubscribers(2, policy))
+			slow := newGatedEventWriter()
+			l.Subscribe(slow)
+			return l, slow
+		}
+
+		c.Specify("will not be stalled by a slow subscriber", func() {
+			l, slow := newLog(ssim.OverflowDropOldest)
+			defer l.Close()
+
+			for i := 0; i < 10; i++ {
+				l.Write(persistedEvent{Actor: ssim.ActorID(i)})
+			}
+
+			slow.open()
+			l.Flush()
+
+			c.Specify("and will drop the oldest events", func() {
+				c.Assume(len(slow.events) > 0, IsTrue)
+				c.Expect(len(slow.events) < 10, IsTrue)
+				c.Expect(slow.events[len(slow.events)-1], Equals, event(9))
+
+				metrics := l.Metrics()
+				c.Assume(len(metrics), Equals, 1)
+				c.Expect(metrics[0].Delivered, Equals, uint64(len(slow.events)))
+				c.Expect(metrics[0].Delivered+metrics[0].Dropped, Equals, uint64(10))
+				c.Expect(metrics[0].Disconnected, IsFalse)
+			})
+		})
+
+		c.Specify("can disconnect a slow subscriber", func() {
+			l, slow := newLog(ssim.OverflowDisconnect)
+			defer l.Close()
+
+			for i := 0; i < 10; i++ {
+				l.Write(persistedEvent{Actor: ssim.ActorID(i)})
+			}
+
+			slow.open()
+			l.Flush()
+
+			// Only an event that was being written when the
+			// subscriber was disconnected can be delivered
+			c.Expect(len(slow.events) <= 1, IsTrue)
+
+			metrics := l.Metrics()
+			c.Assume(len(metrics), Equals, 1)
+			c.Expect(metrics[0].Subscriber, Equals, ssim.EventWriter(slow))
+			c.Expect(metrics[0].Disconnected, IsTrue)
+			c.Expect(metrics[0].Dropped, Equals, uint64(3))
+			c.Expect(metrics[0].Delivered, Equals, uint64(len(slow.events)))
+		})
+
+		c.Specify("will drop the buffered events of a canceled subscriber", func() {
+			l := ssim.NewMemEventLog(nowProvider, ssim.BufferedSubscribers(4, ssim.OverflowBlock))
+			defer l.Close()
+
+			slow := newGatedEventWriter()
+			sub := l.SubscribeCancelable(slow)
+
+			for i := 0; i < 4; i++ {
+				l.Write(persistedEvent{Actor: ssim.ActorID(i)})
+			}
+
+			// Event 0 is being written
+			<-slow.writing
+
+			sub.Cancel()
+			slow.open()
+			l.Flush()
+
+			c.Expect(slow.events, ContainsExactly, []ssim.Event{event(0)})
+
+			metrics := l.Metrics()
+			c.Assume(len(metrics), Equals, 1)
+			c.Expect(metrics[0].Disconnected, IsTrue)
+			c.Expect(metrics[0].Delivered, Equals, uint64(1))
+			c.Expect(metrics[0].Dropped, Equals, uint64(3))
+		})
+
+		c.Specify("can block until a slow subscriber has room", func() {
+			l, slow := newLog(ssim.OverflowBlock)
+			defer l.Close()
+
+			var opened, returnedBeforeOpened int32
+
+			// Event 0 is being written and events 1 and 2
+			// fill the buffer, so the 4th write must block
+			// until the gate has been opened.
+			buffered := make(chan struct{})
+			written := make(chan struct{})
+			go func() {
+				for i := 0; i < 10; i++ {
+					if i == 3 {
+						close(buffered)
+					}
+
+					l.Write(persistedEvent{Actor: ssim.ActorID(i)})
+
+					if i == 3 && atomic.LoadInt32(&opened) == 0 {
+						atomic.StoreInt32(&returnedBeforeOpened, 1)
+					}
+				}
+				close(written)
+			}()
+
+			<-slow.writing
+			<-buffered
+
+			atomic.StoreInt32(&opened, 1)
+			slow.open()
+			<-written
+			l.Flush()
+
+			c.Expect(atomic.LoadInt32(&returnedBeforeOpened), Equals, int32(0))
+
+			c.Expect(slow.events, ContainsInOrder, []ssim.Event{
+				event(0), event(1), event(2), event(3), event(4),
+				event(5), event(6), event(7), event(8), event(9),
+			})
+			c.Expect(len(slow.events), Equals, 10)
+		})
 	})
 }
@@ -0,0 +1,256 @@
+package ssim
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A Reducer folds an Event into the state of a Projection
+// and returns the next state. The state may be read by other
+// go routines so the reducer must return a new value instead
+// of modifying the state it was given.
+type Reducer func(state interface{}, e Event) interface{}
+
+// A Snapshot is the state of a Projection after it has folded
+// every Event in a log prior to Offset.
+type Snapshot struct {
+	Offset Offset
+	State  interface{}
+}
+
+// A SnapshotStore persists the latest Snapshot of a Projection.
+type SnapshotStore interface {
+	SaveSnapshot(Snapshot) error
+	LoadSnapshot() (s Snapshot, exists bool, err error)
+}
+
+// A Projection is a materialized view of an EventLog. It is an
+// EventWriter that must receive every Event in the log, in order,
+// starting from its Offset. Use ReplayAndTail or RestoreProjection
+// to subscribe a Projection to a log that already contains Event's.
+type Projection struct {
+	reduce Reducer
+
+	mu    sync.RWMutex
+	state interface{}
+	next  Offset
+
+	store         SnapshotStore
+	interval      int
+	sinceSnapshot int
+	err           error
+
+	// Serializes saving snapshots so the store
+	// never has an older snapshot saved over a newer one.
+	saving sync.Mutex
+}
+
+type ProjectionOption func(*Projection)
+
+// SnapshotEvery will save a Snapshot of the projection to the
+// store after every n Event's.
+func SnapshotEvery(n int, store SnapshotStore) ProjectionOption {
+	return func(p *Projection) {
+		p.interval = n
+		p.store = store
+	}
+}
+
+// NewProjection returns a Projection of a log beginning at Offset 0.
+func NewProjection(initial interface{}, reduce Reducer, options ...ProjectionOption) *Projection {
+	return newProjection(Snapshot{State: initial}, reduce, options...)
+}
+
+func newProjection(s Snapshot, reduce Reducer, options ...ProjectionOption) *Projection {
+	p := &Projection{
+		reduce: reduce,
+		state:  s.State,
+		next:   s.Offset,
+	}
+
+	for _, o := range options {
+		o(p)
+	}
+
+	return p
+}
+
+// RestoreProjection will restore a Projection from the latest
+// Snapshot in the store, or from initial if the store is empty.
+// The Event's in the log after the Snapshot are replayed and then
+// the Projection is subscribed to the log. Like ReplayAndTail it
+// must be called from the go routine that is writing to the log.
+func RestoreProjection(log EventLog, store SnapshotStore, initial interface{}, reduce Reducer, options ...ProjectionOption) (*Projection, error) {
+	s, exists, err := store.LoadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		s = Snapshot{State: initial}
+	}
+
+	p := newProjection(s, reduce, options...)
+
+	_, err = ReplayAndTail(log, s.Offset, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Projection) Write(e Event) {
+	p.mu.Lock()
+	p.state = p.reduce(p.state, e)
+	p.next++
+
+	var snapshotDue bool
+	if p.store != nil {
+		p.sinceSnapshot++
+		snapshotDue = p.sinceSnapshot >= p.interval
+	}
+	p.mu.Unlock()
+
+	if !snapshotDue {
+		return
+	}
+
+	err := p.Snapshot()
+
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+}
+
+// Value returns the current state of the Projection.
+// It is safe to call from any go routine.
+func (p *Projection) Value() interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+// Offset returns the Offset of the next Event
+// the Projection expects to receive.
+func (p *Projection) Offset() Offset {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.next
+}
+
+// Snapshot saves the current state to the SnapshotStore.
+// It is safe to call from any go routine.
+func (p *Projection) Snapshot() error {
+	if p.store == nil {
+		return nil
+	}
+
+	p.saving.Lock()
+	defer p.saving.Unlock()
+
+	p.mu.Lock()
+	s := Snapshot{p.next, p.state}
+	p.sinceSnapshot = 0
+	p.mu.Unlock()
+
+	return p.store.SaveSnapshot(s)
+}
+
+// Err returns the error from the last periodic Snapshot.
+func (p *Projection) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+type memSnapshotStore struct {
+	mu       sync.Mutex
+	snapshot *Snapshot
+}
+
+// NewMemSnapshotStore returns a SnapshotStore that
+// keeps the latest Snapshot in memory.
+func NewMemSnapshotStore() SnapshotStore {
+	return &memSnapshotStore{}
+}
+
+func (s *memSnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = &snapshot
+	return nil
+}
+
+func (s *memSnapshotStore) LoadSnapshot() (Snapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot == nil {
+		return Snapshot{}, false, nil
+	}
+	return *s.snapshot, true, nil
+}
+
+type fileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore returns a SnapshotStore that saves the
+// latest Snapshot to a file using encoding/gob. The concrete
+// type of the state must be registered with gob.Register.
+func NewFileSnapshotStore(path string) SnapshotStore {
+	return fileSnapshotStore{path}
+}
+
+func (s fileSnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 1024))
+	if err := gob.NewEncoder(buf).Encode(&snapshot); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so
+	// a crash can't leave behind a partial snapshot.
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+func (s fileSnapshotStore) LoadSnapshot() (Snapshot, bool, error) {
+	var snapshot Snapshot
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return snapshot, false, nil
+	}
+
+	if err != nil {
+		return snapshot, false, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot)
+	return snapshot, err == nil, err
+}
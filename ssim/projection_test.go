@@ -0,0 +1,139 @@
+package ssim_test
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/ghthor/filu/ssim"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+// Sums the source id's of every event
+func sumSources(state interface{}, e ssim.Event) interface{} {
+	return state.(int) + int(e.Source())
+}
+
+func DescribeProjection(c gospec.Context) {
+	log := ssim.NewMemEventLog()
+
+	c.Specify("a projection", func() {
+		c.Specify("will fold events into its state", func() {
+			p := ssim.NewProjection(0, sumSources)
+			log.Subscribe(p)
+
+			for i := 1; i <= 4; i++ {
+				log.Write(otherEvent{Actor: ssim.ActorID(i)})
+			}
+
+			c.Expect(p.Value(), Equals, 10)
+			c.Expect(p.Offset(), Equals, ssim.Offset(4))
+		})
+
+		c.Specify("can be read while it is being written to", func() {
+			p := ssim.NewProjection(0, sumSources)
+			log.Subscribe(p)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					log.Write(otherEvent{Actor: 1})
+				}
+			}()
+
+			for i := 0; i < 100; i++ {
+				_ = p.Value()
+			}
+
+			wg.Wait()
+			c.Expect(p.Value(), Equals, 100)
+		})
+
+		c.Specify("will save snapshots periodically", func() {
+			store := ssim.NewMemSnapshotStore()
+			p := ssim.NewProjection(0, sumSources, ssim.SnapshotEvery(2, store))
+			log.Subscribe(p)
+
+			for i := 1; i <= 5; i++ {
+				log.Write(otherEvent{Actor: ssim.ActorID(i)})
+			}
+
+			s, exists, err := store.LoadSnapshot()
+			c.Assume(err, IsNil)
+			c.Assume(exists, IsTrue)
+			c.Expect(s, Equals, ssim.Snapshot{Offset: 4, State: 10})
+
+			c.Specify("and can be restored from a snapshot and the log", func() {
+				log.Write(otherEvent{Actor: 6})
+
+				restored, err := ssim.RestoreProjection(log, store, 0, sumSources)
+				c.Assume(err, IsNil)
+				c.Expect(restored.Value(), Equals, 21)
+				c.Expect(restored.Offset(), Equals, ssim.Offset(6))
+
+				log.Write(otherEvent{Actor: 7})
+				c.Expect(restored.Value(), Equals, 28)
+				c.Expect(restored.Value(), Equals, p.Value())
+			})
+		})
+
+		c.Specify("can be snapshotted while it is being written to", func() {
+			store := ssim.NewMemSnapshotStore()
+			p := ssim.NewProjection(0, sumSources, ssim.SnapshotEvery(3, store))
+			log.Subscribe(p)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					log.Write(otherEvent{Actor: 1})
+				}
+			}()
+
+			for i := 0; i < 100; i++ {
+				c.Assume(p.Snapshot(), IsNil)
+			}
+
+			wg.Wait()
+			c.Expect(p.Err(), IsNil)
+			c.Expect(p.Snapshot(), IsNil)
+
+			s, exists, err := store.LoadSnapshot()
+			c.Assume(err, IsNil)
+			c.Assume(exists, IsTrue)
+			c.Expect(s, Equals, ssim.Snapshot{Offset: 100, State: 100})
+		})
+
+		c.Specify("can be restored from an empty store", func() {
+			log.Write(otherEvent{Actor: 1})
+			log.Write(otherEvent{Actor: 2})
+
+			p, err := ssim.RestoreProjection(log, ssim.NewMemSnapshotStore(), 0, sumSources)
+			c.Assume(err, IsNil)
+			c.Expect(p.Value(), Equals, 3)
+		})
+	})
+
+	c.Specify("a file snapshot store", func() {
+		dir := tempDir(c)
+		defer removeDir(dir)
+
+		store := ssim.NewFileSnapshotStore(filepath.Join(dir, "snapshot"))
+
+		_, exists, err := store.LoadSnapshot()
+		c.Expect(err, IsNil)
+		c.Expect(exists, IsFalse)
+
+		c.Expect(store.SaveSnapshot(ssim.Snapshot{Offset: 1, State: 1}), IsNil)
+		c.Expect(store.SaveSnapshot(ssim.Snapshot{Offset: 2, State: 3}), IsNil)
+
+		s, exists, err := store.LoadSnapshot()
+		c.Expect(err, IsNil)
+		c.Expect(exists, IsTrue)
+		c.Expect(s, Equals, ssim.Snapshot{Offset: 2, State: 3})
+	})
+}
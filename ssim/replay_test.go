@@ -0,0 +1,124 @@
+package ssim_test
+
+import (
+	"io"
+	"time"
+
+	"github.com/ghthor/filu/ssim"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+func describeReplayingAnEventLog(c gospec.Context, newLog func(now func() time.Time) ssim.EventLog) {
+	start, err := time.Parse(time.RFC3339, "2015-04-01T00:00:00Z")
+	c.Assume(err, IsNil)
+
+	now := start
+	l := newLog(func() time.Time { return now })
+
+	for i := 0; i < 5; i++ {
+		l.Write(persistedEvent{Actor: ssim.ActorID(i)})
+		now = now.Add(time.Second)
+	}
+
+	accepted := func(i int) ssim.Event {
+		return persistedEvent{
+			Actor:    ssim.ActorID(i),
+			Accepted: start.Add(time.Duration(i) * time.Second),
+		}
+	}
+
+	c.Specify("can be read from an offset", func() {
+		r := l.ReadFrom(3)
+		defer r.Close()
+
+		offset, e, err := r.Next()
+		c.Expect(err, IsNil)
+		c.Expect(offset, Equals, ssim.Offset(3))
+		c.Expect(e, Equals, accepted(3))
+
+		offset, e, err = r.Next()
+		c.Expect(err, IsNil)
+		c.Expect(offset, Equals, ssim.Offset(4))
+		c.Expect(e, Equals, accepted(4))
+
+		_, _, err = r.Next()
+		c.Expect(err, Equals, io.EOF)
+
+		c.Specify("and will continue reading after the log is written to", func() {
+			l.Write(persistedEvent{Actor: 5})
+
+			offset, e, err = r.Next()
+			c.Expect(err, IsNil)
+			c.Expect(offset, Equals, ssim.Offset(5))
+			c.Expect(e, Equals, accepted(5))
+		})
+	})
+
+	c.Specify("can seek to an offset by the time an event was accepted", func() {
+		offset, err := l.OffsetAt(start.Add(2 * time.Second))
+		c.Expect(err, IsNil)
+		c.Expect(offset, Equals, ssim.Offset(2))
+
+		offset, err = l.OffsetAt(start.Add(1500 * time.Millisecond))
+		c.Expect(err, IsNil)
+		c.Expect(offset, Equals, ssim.Offset(2))
+
+		offset, err = l.OffsetAt(start.Add(time.Hour))
+		c.Expect(err, IsNil)
+		c.Expect(offset, Equals, ssim.Offset(5))
+	})
+
+	c.Specify("can be replayed to an event writer", func() {
+		out := &eventRecorder{}
+		next, err := ssim.Replay(l, 1, out)
+		c.Expect(err, IsNil)
+		c.Expect(next, Equals, ssim.Offset(5))
+		c.Expect(out.events, ContainsInOrder, []ssim.Event{
+			accepted(1), accepted(2), accepted(3), accepted(4),
+		})
+		c.Expect(len(out.events), Equals, 4)
+	})
+
+	c.Specify("can be replayed and then tailed", func() {
+		out := &eventRecorder{}
+		next, err := ssim.ReplayAndTail(l, 3, out)
+		c.Expect(err, IsNil)
+		c.Expect(next, Equals, ssim.Offset(5))
+
+		l.Write(persistedEvent{Actor: 5})
+		c.Expect(out.events, ContainsInOrder, []ssim.Event{
+			accepted(3), accepted(4), accepted(5),
+		})
+		c.Expect(len(out.events), Equals, 3)
+	})
+}
+
+func DescribeEventLogReplay(c gospec.Context) {
+	c.Specify("a memory event log", func() {
+		describeReplayingAnEventLog(c, func(now func() time.Time) ssim.EventLog {
+			return ssim.NewMemEventLog(ssim.NowProvider(now))
+		})
+	})
+
+	c.Specify("a file event log", func() {
+		dir := tempDir(c)
+		defer removeDir(dir)
+
+		var l ssim.FileEventLog
+		defer func() {
+			c.Assume(l.Close(), IsNil)
+		}()
+
+		describeReplayingAnEventLog(c, func(now func() time.Time) ssim.EventLog {
+			var err error
+			l, err = ssim.OpenFileEventLog(dir,
+				ssim.FileNowProvider(now),
+				// Force every event into its own segment
+				ssim.FileSegmentSize(1))
+			c.Assume(err, IsNil)
+			return l
+		})
+	})
+}
@@ -0,0 +1,136 @@
+package ssim
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Implements EventEmitter for the stream combinators.
+type eventEmitter struct {
+	subs []EventWriter
+}
+
+func (em *eventEmitter) Subscribe(w EventWriter) {
+	em.subs = append(em.subs, w)
+}
+
+func (em *eventEmitter) emit(e Event) {
+	for _, s := range em.subs {
+		s.Write(e)
+	}
+}
+
+type eventFilter struct {
+	keep func(Event) bool
+	*eventEmitter
+}
+
+// NewEventFilter returns an EventStream that will only
+// emit the Event's that keep returns true for.
+func NewEventFilter(keep func(Event) bool) EventStream {
+	return eventFilter{keep, &eventEmitter{}}
+}
+
+func (f eventFilter) Write(e Event) {
+	if f.keep(e) {
+		f.emit(e)
+	}
+}
+
+// FilterByType returns an EventStream that will only emit
+// Event's that have the same concrete type as one of the
+// example events.
+func FilterByType(examples ...Event) EventStream {
+	types := make(map[reflect.Type]bool, len(examples))
+	for _, e := range examples {
+		types[reflect.TypeOf(e)] = true
+	}
+
+	return NewEventFilter(func(e Event) bool {
+		return types[reflect.TypeOf(e)]
+	})
+}
+
+// FilterBySource returns an EventStream that will only
+// emit Event's that were produced by one of the actors.
+func FilterBySource(actors ...ActorID) EventStream {
+	sources := make(map[ActorID]bool, len(actors))
+	for _, id := range actors {
+		sources[id] = true
+	}
+
+	return NewEventFilter(func(e Event) bool {
+		return sources[e.Source()]
+	})
+}
+
+type eventMap struct {
+	fn func(Event) []Event
+	*eventEmitter
+}
+
+// NewEventMap returns an EventStream that will emit the
+// zero or more Event's fn returns for every Event written
+// to the stream.
+func NewEventMap(fn func(Event) []Event) EventStream {
+	return eventMap{fn, &eventEmitter{}}
+}
+
+func (m eventMap) Write(e Event) {
+	for _, e := range m.fn(e) {
+		m.emit(e)
+	}
+}
+
+type eventFanOut struct {
+	*eventEmitter
+}
+
+// NewEventFanOut returns an EventStream that will write every
+// Event to each of the branches, in order, and then to any
+// subscribers of the stream.
+func NewEventFanOut(branches ...EventWriter) EventStream {
+	em := &eventEmitter{}
+	for _, b := range branches {
+		em.Subscribe(b)
+	}
+
+	return eventFanOut{em}
+}
+
+func (f eventFanOut) Write(e Event) {
+	f.emit(e)
+}
+
+type eventMerge struct {
+	mu *sync.Mutex
+	*eventEmitter
+}
+
+// NewEventMerge returns an EventStream that will emit every
+// Event emitted by the streams and every Event written to it.
+// The streams can emit Event's from separate go routines, the
+// subscribers of the merged stream will never be written to
+// concurrently.
+func NewEventMerge(streams ...EventEmitter) EventStream {
+	m := eventMerge{&sync.Mutex{}, &eventEmitter{}}
+	for _, s := range streams {
+		s.Subscribe(m)
+	}
+
+	return m
+}
+
+func (m eventMerge) Write(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emit(e)
+}
+
+func (m eventMerge) Subscribe(w EventWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.eventEmitter.Subscribe(w)
+}
@@ -0,0 +1,105 @@
+package ssim_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghthor/filu/ssim"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+type otherEvent struct {
+	Actor ssim.ActorID
+}
+
+func (e otherEvent) Source() ssim.ActorID          { return e.Actor }
+func (e otherEvent) IssuedAt() time.Time           { return time.Time{} }
+func (e otherEvent) AcceptAt(time.Time) ssim.Event { return e }
+
+func DescribeEventRouting(c gospec.Context) {
+	out := &eventRecorder{}
+
+	c.Specify("a filter", func() {
+		c.Specify("can filter by event type", func() {
+			f := ssim.FilterByType(otherEvent{})
+			f.Subscribe(out)
+
+			f.Write(persistedEvent{Actor: 1})
+			f.Write(otherEvent{Actor: 2})
+			c.Expect(out.events, ContainsExactly, []ssim.Event{otherEvent{Actor: 2}})
+		})
+
+		c.Specify("can filter by actor", func() {
+			f := ssim.FilterBySource(1, 3)
+			f.Subscribe(out)
+
+			for i := 0; i < 4; i++ {
+				f.Write(otherEvent{Actor: ssim.ActorID(i)})
+			}
+			c.Expect(out.events, ContainsExactly, []ssim.Event{
+				otherEvent{Actor: 1},
+				otherEvent{Actor: 3},
+			})
+		})
+	})
+
+	c.Specify("a map", func() {
+		m := ssim.NewEventMap(func(e ssim.Event) []ssim.Event {
+			events := make([]ssim.Event, 0, int(e.Source()))
+			for i := 0; i < int(e.Source()); i++ {
+				events = append(events, otherEvent{Actor: ssim.ActorID(i)})
+			}
+			return events
+		})
+		m.Subscribe(out)
+
+		m.Write(otherEvent{Actor: 0})
+		c.Expect(len(out.events), Equals, 0)
+
+		m.Write(otherEvent{Actor: 2})
+		c.Expect(out.events, ContainsInOrder, []ssim.Event{
+			otherEvent{Actor: 0},
+			otherEvent{Actor: 1},
+		})
+	})
+
+	c.Specify("a fan out", func() {
+		a, b := &eventRecorder{}, &eventRecorder{}
+		branchA, branchB := ssim.FilterBySource(1), ssim.FilterBySource(2)
+		branchA.Subscribe(a)
+		branchB.Subscribe(b)
+
+		f := ssim.NewEventFanOut(branchA, branchB)
+		f.Subscribe(out)
+
+		f.Write(otherEvent{Actor: 1})
+		f.Write(otherEvent{Actor: 2})
+
+		c.Expect(a.events, ContainsExactly, []ssim.Event{otherEvent{Actor: 1}})
+		c.Expect(b.events, ContainsExactly, []ssim.Event{otherEvent{Actor: 2}})
+		c.Expect(len(out.events), Equals, 2)
+	})
+
+	c.Specify("a merge", func() {
+		a, b := ssim.FilterBySource(1), ssim.FilterBySource(2)
+		m := ssim.NewEventMerge(a, b)
+		m.Subscribe(out)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		for _, s := range []ssim.EventStream{a, b} {
+			go func(s ssim.EventStream) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					s.Write(otherEvent{Actor: 1})
+					s.Write(otherEvent{Actor: 2})
+				}
+			}(s)
+		}
+		wg.Wait()
+
+		c.Expect(len(out.events), Equals, 200)
+	})
+}
@@ -2,7 +2,10 @@
 // of an append only log of immutable Event's.
 package ssim
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 // A ActorID is a unique ID assigned to an actor.
 type ActorID int
@@ -33,6 +36,31 @@ type EventWriter interface {
 	Write(Event)
 }
 
+// A Subscription is the handle of an EventWriter
+// that has been subscribed to an EventEmitter.
+type Subscription interface {
+	// Cancel will unsubscribe the EventWriter.
+	// It is safe to call Cancel more than once.
+	Cancel()
+
+	// Done is closed when the subscription has ended.
+	Done() <-chan struct{}
+}
+
+// A CancelableEventEmitter is an EventEmitter
+// that can unsubscribe its subscribers.
+type CancelableEventEmitter interface {
+	EventEmitter
+	SubscribeCancelable(EventWriter) Subscription
+}
+
+// An EventWriteCloser is an EventWriter that will be closed
+// when the synced stream it was subscribed to is halted.
+type EventWriteCloser interface {
+	EventWriter
+	Close()
+}
+
 // An EventStream can receive Event's and will
 // emit them to all subscriber's.
 type EventStream interface {
@@ -40,6 +68,75 @@ type EventStream interface {
 	EventEmitter
 }
 
+// An Offset is the position of an Event within an EventLog.
+// The first Event written to a log is at Offset 0.
+type Offset int64
+
+// An EventReader reads the Event's retained by an EventLog
+// in the order they were written to the log.
+type EventReader interface {
+	// Next returns the next Event and its Offset. Returns
+	// io.EOF after the last Event in the log has been read.
+	// Calling Next again after the log has been written to
+	// will continue to read the new Event's.
+	Next() (Offset, Event, error)
+
+	Close() error
+}
+
+// An EventLog is an EventStream that retains the Event's
+// written to it so they can be read again.
+type EventLog interface {
+	EventStream
+
+	// ReadFrom returns an EventReader that begins at offset.
+	ReadFrom(Offset) EventReader
+
+	// OffsetAt returns the Offset of the first Event that was
+	// accepted at or after t. If there isn't one the Offset
+	// the next Event will be written at is returned.
+	OffsetAt(time.Time) (Offset, error)
+}
+
+// Replay will write every Event in the log beginning at offset
+// `from` to w. It returns the Offset the next Event will be
+// written to the log at.
+func Replay(log EventLog, from Offset, w EventWriter) (next Offset, err error) {
+	r := log.ReadFrom(from)
+	defer r.Close()
+
+	next = from
+	for {
+		offset, e, err := r.Next()
+		switch err {
+		case nil:
+		case io.EOF:
+			return next, nil
+		default:
+			return next, err
+		}
+
+		w.Write(e)
+		next = offset + 1
+	}
+}
+
+// ReplayAndTail will Replay the log to w and then subscribe
+// w to the log so it will continue to receive every Event
+// written to the log. The log must not be written to during
+// the call, which is guaranteed when it is called from the
+// go routine that synchronizes access to the log. Otherwise
+// w may miss Event's that are written during the Replay.
+func ReplayAndTail(log EventLog, from Offset, w EventWriter) (next Offset, err error) {
+	next, err = Replay(log, from, w)
+	if err != nil {
+		return next, err
+	}
+
+	log.Subscribe(w)
+	return next, nil
+}
+
 // NewEventPipeline will chain `n` EventStreams together with streams[0]
 // as the entry point and streams[len(streams)-1] being the exit point.
 func NewEventPipeline(streams ...EventStream) EventStream {
@@ -0,0 +1,252 @@
+package ssim
+
+import (
+	"sync"
+	"time"
+)
+
+// An AcceptedEvent is an Event that can report
+// the time it was accepted by the server.
+type AcceptedEvent interface {
+	Event
+	AcceptedAt() time.Time
+}
+
+// A SkewEstimate is an estimate of the relationship between
+// an actor's clock and the server's clock.
+type SkewEstimate struct {
+	// The number of events the estimate is based on.
+	Samples int
+
+	// The difference between the accept and issue
+	// times of the most recent event.
+	Last time.Duration
+
+	// The lowest difference between the accept and issue times,
+	// which is the clock skew plus the minimum network latency.
+	// Decays toward recent samples so the estimate follows
+	// an actor's clock if it is adjusted. It only moves a
+	// limited amount per sample and only with samples within
+	// the tracker's bounds, so it is always a plausible skew.
+	Offset time.Duration
+
+	// A moving average of how far the events have been
+	// delayed beyond the Offset.
+	Latency time.Duration
+}
+
+const (
+	skewOffsetDecay = 64
+	skewLatencyGain = 8
+
+	// The most the Offset can move with a single sample
+	skewOffsetMaxStep = 100 * time.Millisecond
+)
+
+// Adds a sample that is within the tracker's bounds.
+func (s SkewEstimate) add(d time.Duration) SkewEstimate {
+	var step time.Duration
+	switch {
+	case s.Samples == 0:
+		step = d
+	case d < s.Offset:
+		step = d - s.Offset
+		if step < -skewOffsetMaxStep {
+			step = -skewOffsetMaxStep
+		}
+	default:
+		step = (d - s.Offset) / skewOffsetDecay
+		if step > skewOffsetMaxStep {
+			step = skewOffsetMaxStep
+		}
+	}
+
+	s.Offset += step
+	s.Latency += ((d - s.Offset) - s.Latency) / skewLatencyGain
+	s.Last = d
+	s.Samples++
+	return s
+}
+
+// A sample outside of the tracker's bounds doesn't move the
+// Offset, so an actor can't drag the estimate to an
+// implausible skew and have its events accepted.
+func (s SkewEstimate) addImplausible(d time.Duration) SkewEstimate {
+	s.Last = d
+	s.Samples++
+	return s
+}
+
+// A SkewReason describes why an Event's IssuedAt is implausible.
+type SkewReason int
+
+const (
+	SkewNone SkewReason = iota
+	SkewIssuedInFuture
+	SkewIssuedTooLongAgo
+)
+
+// A SkewedEvent is an Event with an implausible IssuedAt.
+type SkewedEvent struct {
+	Event
+	Reason SkewReason
+
+	// The difference between the accept and issue times
+	Skew time.Duration
+
+	// The actor's estimate before the event was accepted.
+	// The event is implausible because the Skew is outside
+	// of the tracker's bounds or is too far from the
+	// estimate's Offset.
+	Estimate SkewEstimate
+}
+
+func (e SkewedEvent) AcceptAt(t time.Time) Event {
+	e.Event = e.Event.AcceptAt(t)
+	return e
+}
+
+// A SkewTracker is an EventStream that estimates the clock skew
+// and latency of each actor from the IssuedAt and accept times of
+// their events. Events with an implausible IssuedAt are emitted
+// as a SkewedEvent, or are rejected if the tracker has been
+// configured to do so with RejectSkewedEvents.
+type SkewTracker struct {
+	mu        sync.Mutex
+	estimates map[ActorID]SkewEstimate
+
+	maxFuture, maxPast time.Duration
+	rejected           EventWriter
+
+	now func() time.Time
+	*eventEmitter
+}
+
+type SkewTrackerOption func(*SkewTracker)
+
+func SkewNowProvider(now func() time.Time) SkewTrackerOption {
+	return func(t *SkewTracker) {
+		t.now = now
+	}
+}
+
+// MaxFutureSkew is how far after the accept time an event's
+// IssuedAt may be before it is implausible. It bounds both the
+// IssuedAt and the IssuedAt adjusted by the actor's Offset.
+func MaxFutureSkew(d time.Duration) SkewTrackerOption {
+	return func(t *SkewTracker) {
+		t.maxFuture = d
+	}
+}
+
+// MaxPastSkew is how far before the accept time an event's
+// IssuedAt may be before it is implausible. It bounds both the
+// IssuedAt and the IssuedAt adjusted by the actor's Offset.
+func MaxPastSkew(d time.Duration) SkewTrackerOption {
+	return func(t *SkewTracker) {
+		t.maxPast = d
+	}
+}
+
+// RejectSkewedEvents will write every SkewedEvent to w
+// instead of emitting it to the subscribers.
+func RejectSkewedEvents(w EventWriter) SkewTrackerOption {
+	return func(t *SkewTracker) {
+		t.rejected = w
+	}
+}
+
+// NewSkewTracker returns a SkewTracker. The time an event was
+// accepted is read from events that implement AcceptedEvent,
+// otherwise the tracker uses the time it received the event.
+func NewSkewTracker(options ...SkewTrackerOption) *SkewTracker {
+	t := &SkewTracker{
+		estimates: make(map[ActorID]SkewEstimate),
+
+		maxFuture: time.Second,
+		maxPast:   5 * time.Second,
+
+		now:          time.Now,
+		eventEmitter: &eventEmitter{},
+	}
+
+	for _, o := range options {
+		o(t)
+	}
+
+	return t
+}
+
+func (t *SkewTracker) Write(e Event) {
+	var acceptedAt time.Time
+	if accepted, ok := e.(AcceptedEvent); ok {
+		acceptedAt = accepted.AcceptedAt()
+	} else {
+		acceptedAt = t.now()
+	}
+
+	skew := acceptedAt.Sub(e.IssuedAt())
+
+	t.mu.Lock()
+	estimate := t.estimates[e.Source()]
+
+	// The skew is always bounded by the server's clock, an
+	// actor's clock can't be further ahead or behind than the
+	// bounds allow no matter how many events it has issued.
+	reason := t.bound(skew)
+	if reason == SkewNone {
+		t.estimates[e.Source()] = estimate.add(skew)
+
+		// A lag spike is a skew that is too far from the actor's
+		// estimated offset. Without an estimate the offset is 0.
+		reason = t.bound(skew - estimate.Offset)
+	} else {
+		t.estimates[e.Source()] = estimate.addImplausible(skew)
+	}
+	t.mu.Unlock()
+
+	if reason == SkewNone {
+		t.emit(e)
+		return
+	}
+
+	skewed := SkewedEvent{
+		Event:    e,
+		Reason:   reason,
+		Skew:     skew,
+		Estimate: estimate,
+	}
+
+	if t.rejected != nil {
+		t.rejected.Write(skewed)
+		return
+	}
+
+	t.emit(skewed)
+}
+
+func (t *SkewTracker) bound(skew time.Duration) SkewReason {
+	switch {
+	case skew < -t.maxFuture:
+		return SkewIssuedInFuture
+	case skew > t.maxPast:
+		return SkewIssuedTooLongAgo
+	}
+	return SkewNone
+}
+
+// Estimate returns the current estimate for an actor.
+// It is safe to call from any go routine.
+func (t *SkewTracker) Estimate(id ActorID) (SkewEstimate, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	estimate, exists := t.estimates[id]
+	return estimate, exists
+}
+
+// Forget removes the estimate of an actor that has disconnected.
+func (t *SkewTracker) Forget(id ActorID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.estimates, id)
+}
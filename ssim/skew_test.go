@@ -0,0 +1,179 @@
+package ssim_test
+
+import (
+	"time"
+
+	"github.com/ghthor/filu/ssim"
+
+	"github.com/ghthor/gospec"
+	. "github.com/ghthor/gospec"
+)
+
+type issuedEvent struct {
+	Actor  ssim.ActorID
+	Issued time.Time
+}
+
+func (e issuedEvent) Source() ssim.ActorID          { return e.Actor }
+func (e issuedEvent) IssuedAt() time.Time           { return e.Issued }
+func (e issuedEvent) AcceptAt(time.Time) ssim.Event { return e }
+
+// Returns the number of events that are a SkewedEvent
+func skewedEvents(events []ssim.Event) (n int) {
+	for _, e := range events {
+		if _, isSkewed := e.(ssim.SkewedEvent); isSkewed {
+			n++
+		}
+	}
+	return n
+}
+
+func DescribeSkewTracker(c gospec.Context) {
+	now, err := time.Parse(time.RFC3339, "2015-04-01T00:00:00Z")
+	c.Assume(err, IsNil)
+
+	issued := func(id ssim.ActorID, ago time.Duration) ssim.Event {
+		return issuedEvent{id, now.Add(-ago)}
+	}
+
+	out := &eventRecorder{}
+	options := []ssim.SkewTrackerOption{
+		ssim.SkewNowProvider(func() time.Time { return now }),
+		ssim.MaxFutureSkew(time.Second),
+		ssim.MaxPastSkew(10 * time.Second),
+	}
+
+	c.Specify("a skew tracker", func() {
+		t := ssim.NewSkewTracker(options...)
+		t.Subscribe(out)
+
+		c.Specify("will estimate an actor's skew and latency", func() {
+			t.Write(issued(1, 100*time.Millisecond))
+			t.Write(issued(1, 150*time.Millisecond))
+			t.Write(issued(2, -500*time.Millisecond))
+
+			estimate, exists := t.Estimate(1)
+			c.Assume(exists, IsTrue)
+			c.Expect(estimate.Samples, Equals, 2)
+			c.Expect(estimate.Last, Equals, 150*time.Millisecond)
+			c.Expect(estimate.Offset > 100*time.Millisecond, IsTrue)
+			c.Expect(estimate.Offset < 150*time.Millisecond, IsTrue)
+			c.Expect(estimate.Latency > 0, IsTrue)
+
+			estimate, exists = t.Estimate(2)
+			c.Assume(exists, IsTrue)
+			c.Expect(estimate.Offset, Equals, -500*time.Millisecond)
+
+			c.Expect(out.events, ContainsExactly, []ssim.Event{
+				issued(1, 100*time.Millisecond),
+				issued(1, 150*time.Millisecond),
+				issued(2, -500*time.Millisecond),
+			})
+
+			c.Specify("and can forget an actor", func() {
+				t.Forget(1)
+				_, exists := t.Estimate(1)
+				c.Expect(exists, IsFalse)
+			})
+		})
+
+		c.Specify("will annotate an event issued in the future", func() {
+			t.Write(issued(1, -2*time.Second))
+
+			c.Assume(len(out.events), Equals, 1)
+			skewed, isSkewed := out.events[0].(ssim.SkewedEvent)
+			c.Assume(isSkewed, IsTrue)
+			c.Expect(skewed.Reason, Equals, ssim.SkewIssuedInFuture)
+			c.Expect(skewed.Skew, Equals, -2*time.Second)
+			c.Expect(skewed.Event, Equals, issued(1, -2*time.Second))
+
+			// Doesn't move the estimate toward the skew
+			estimate, exists := t.Estimate(1)
+			c.Assume(exists, IsTrue)
+			c.Expect(estimate.Offset, Equals, time.Duration(0))
+			c.Expect(estimate.Samples, Equals, 1)
+		})
+
+		c.Specify("will annotate an event issued too long ago", func() {
+			t.Write(issued(1, time.Minute))
+
+			c.Assume(len(out.events), Equals, 1)
+			skewed, isSkewed := out.events[0].(ssim.SkewedEvent)
+			c.Assume(isSkewed, IsTrue)
+			c.Expect(skewed.Reason, Equals, ssim.SkewIssuedTooLongAgo)
+		})
+
+		c.Specify("will compare an event's skew to the actor's estimate", func() {
+			// The actor's clock is 900ms ahead of the server's
+			for i := 0; i < 10; i++ {
+				t.Write(issued(1, -900*time.Millisecond))
+			}
+
+			c.Assume(len(out.events), Equals, 10)
+			c.Expect(skewedEvents(out.events), Equals, 0)
+
+			estimate, _ := t.Estimate(1)
+			c.Expect(estimate.Offset, Equals, -900*time.Millisecond)
+
+			c.Specify("and annotate a lag spike", func() {
+				t.Write(issued(1, 9500*time.Millisecond))
+
+				skewed, isSkewed := out.events[len(out.events)-1].(ssim.SkewedEvent)
+				c.Assume(isSkewed, IsTrue)
+				c.Expect(skewed.Reason, Equals, ssim.SkewIssuedTooLongAgo)
+				c.Expect(skewed.Estimate, Equals, estimate)
+			})
+		})
+
+		c.Specify("will never accept the events of an actor with an implausible offset", func() {
+			// The actor's clock is 20s behind the server's
+			for i := 0; i < 100; i++ {
+				t.Write(issued(1, 20*time.Second))
+			}
+
+			c.Expect(skewedEvents(out.events), Equals, 100)
+
+			estimate, _ := t.Estimate(1)
+			c.Expect(estimate.Offset, Equals, time.Duration(0))
+			c.Expect(estimate.Samples, Equals, 100)
+		})
+
+		c.Specify("will not accept the events of an actor that walks its IssuedAt forward", func() {
+			walk := func(step time.Duration) {
+				for i := 1; i <= 60; i++ {
+					t.Write(issued(1, -time.Duration(i)*step))
+				}
+			}
+
+			c.Specify("by a large step", func() {
+				walk(900 * time.Millisecond)
+				c.Expect(skewedEvents(out.events), Equals, 59)
+			})
+
+			c.Specify("by a small step", func() {
+				walk(100 * time.Millisecond)
+				c.Expect(skewedEvents(out.events), Equals, 50)
+			})
+
+			for _, e := range out.events[len(out.events)-50:] {
+				c.Expect(e.(ssim.SkewedEvent).Reason, Equals, ssim.SkewIssuedInFuture)
+			}
+
+			estimate, _ := t.Estimate(1)
+			c.Expect(estimate.Offset >= -time.Second, IsTrue)
+		})
+	})
+
+	c.Specify("a rejecting skew tracker", func() {
+		rejected := &eventRecorder{}
+		t := ssim.NewSkewTracker(append(options, ssim.RejectSkewedEvents(rejected))...)
+		t.Subscribe(out)
+
+		t.Write(issued(1, time.Minute))
+		t.Write(issued(1, time.Millisecond))
+
+		c.Expect(out.events, ContainsExactly, []ssim.Event{issued(1, time.Millisecond)})
+		c.Assume(len(rejected.events), Equals, 1)
+		c.Expect(rejected.events[0].(ssim.SkewedEvent).Event, Equals, issued(1, time.Minute))
+	})
+}
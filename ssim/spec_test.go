@@ -10,9 +10,16 @@ func TestUnitSpecs(t *testing.T) {
 	r := gospec.NewRunner()
 
 	r.AddSpec(DescribeMemEventLog)
+	r.AddSpec(DescribeBufferedMemEventLog)
+	r.AddSpec(DescribeFileEventLog)
+	r.AddSpec(DescribeEventLogReplay)
 
 	r.AddSpec(DescribePipelines)
+	r.AddSpec(DescribeEventRouting)
+	r.AddSpec(DescribeProjection)
+	r.AddSpec(DescribeSkewTracker)
 	r.AddSpec(DescribeSyncedStream)
+	r.AddSpec(DescribeSyncedStreamSubscriptions)
 
 	gospec.MainGoTest(r, t)
 }
@@ -1,5 +1,10 @@
 package ssim
 
+import (
+	"context"
+	"sync/atomic"
+)
+
 // A SelectableEventWriter is an EventWriter that
 // is easier to write to from a select statement.
 type SelectableEventWriter interface {
@@ -9,6 +14,9 @@ type SelectableEventWriter interface {
 // A SelectableEventEmitter is an EventEmitter that
 // is easier to subscribe to from a select statement.
 type SelectableEventEmitter interface {
+	// A subscription made by sending to Subscribe can't be
+	// canceled by the subscriber, it ends when the stream is
+	// halted. Use SubscribeContext for a cancelable subscription.
 	Subscribe() chan<- EventWriter
 }
 
@@ -17,6 +25,16 @@ type SelectableEventEmitter interface {
 type SelectableEventStream interface {
 	SelectableEventWriter
 	SelectableEventEmitter
+
+	// SubscribeContext will subscribe w to the stream. The
+	// Subscription will be canceled when ctx is done.
+	SubscribeContext(ctx context.Context, w EventWriter) Subscription
+
+	// HaltStream will end every subscription made with Subscribe
+	// or SubscribeContext, closing any of those subscribers that
+	// is an EventWriteCloser, and return the EventStream that
+	// was being synchronized. Subscribers that were subscribed
+	// directly to the EventStream remain subscribed to it.
 	HaltStream() EventStream
 }
 
@@ -24,11 +42,20 @@ type eventStreamHaltReq struct {
 	hasHalted chan<- EventStream
 }
 
+type eventStreamSubscribeReq struct {
+	w          EventWriter
+	subscribed chan<- *syncedSubscription
+}
+
 type syncedEventStream struct {
 	in   chan<- Event
 	subs chan<- EventWriter
 
-	halt chan<- eventStreamHaltReq
+	subscribe   chan<- eventStreamSubscribeReq
+	unsubscribe chan<- *syncedSubscription
+
+	halt   chan<- eventStreamHaltReq
+	halted <-chan struct{}
 }
 
 func (s syncedEventStream) Write() chan<- Event {
@@ -39,12 +66,103 @@ func (s syncedEventStream) Subscribe() chan<- EventWriter {
 	return s.subs
 }
 
+func (s syncedEventStream) SubscribeContext(ctx context.Context, w EventWriter) Subscription {
+	subscribed := make(chan *syncedSubscription, 1)
+
+	select {
+	case s.subscribe <- eventStreamSubscribeReq{w, subscribed}:
+	case <-s.halted:
+		return haltedSubscription
+	}
+
+	sub := <-subscribed
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				sub.Cancel()
+			case <-sub.done:
+			}
+		}()
+	}
+
+	return sub
+}
+
 func (s syncedEventStream) HaltStream() EventStream {
 	stream := make(chan EventStream)
 	s.halt <- eventStreamHaltReq{stream}
 	return <-stream
 }
 
+type syncedSubscription struct {
+	w EventWriter
+
+	// Used to unsubscribe if the stream is a CancelableEventEmitter
+	inner Subscription
+	// Set when the subscription ends so the subscription will
+	// stop writing to w even if it can't be unsubscribed
+	// because the stream is NOT a CancelableEventEmitter.
+	canceled int32
+
+	unsubscribe chan<- *syncedSubscription
+	halted      <-chan struct{}
+	done        chan struct{}
+}
+
+func (s *syncedSubscription) Write(e Event) {
+	if atomic.LoadInt32(&s.canceled) == 0 {
+		s.w.Write(e)
+	}
+}
+
+// Cancel may be called by the subscriber from within Write,
+// in which case the subscription will end asynchronously.
+func (s *syncedSubscription) Cancel() {
+	select {
+	case s.unsubscribe <- s:
+		return
+	case <-s.halted:
+		return
+	case <-s.done:
+		return
+	default:
+	}
+
+	go func() {
+		select {
+		case s.unsubscribe <- s:
+		case <-s.halted:
+		case <-s.done:
+		}
+	}()
+}
+
+func (s *syncedSubscription) Done() <-chan struct{} { return s.done }
+
+// Must only be called by the go routine synchronizing the stream.
+func (s *syncedSubscription) end() {
+	atomic.StoreInt32(&s.canceled, 1)
+
+	if s.inner != nil {
+		s.inner.Cancel()
+	}
+
+	close(s.done)
+}
+
+type endedSubscription chan struct{}
+
+func (endedSubscription) Cancel()                 {}
+func (s endedSubscription) Done() <-chan struct{} { return s }
+
+var haltedSubscription = func() Subscription {
+	done := make(endedSubscription)
+	close(done)
+	return done
+}()
+
 // NewSyncedEventStream starts a go routine that synchronizes
 // access to an EventStream. It returns an interface that is
 // friendly to usage from a select statement.
@@ -54,9 +172,23 @@ func NewSyncedEventStream(stream EventStream) SelectableEventStream {
 
 		in   <-chan Event
 		subs <-chan EventWriter
+
+		subscribe   <-chan eventStreamSubscribeReq
+		unsubscribe <-chan *syncedSubscription
+
 		halt <-chan eventStreamHaltReq
 	)
 
+	// The subscribe and unsubscribe channels are never closed so
+	// subscription handles can select on them after the halt.
+	subscribeCh := make(chan eventStreamSubscribeReq)
+	unsubscribeCh := make(chan *syncedSubscription)
+	haltedCh := make(chan struct{})
+
+	sync.subscribe, subscribe = subscribeCh, subscribeCh
+	sync.unsubscribe, unsubscribe = unsubscribeCh, unsubscribeCh
+	sync.halted = haltedCh
+
 	closeChans := func() func() {
 		var (
 			inCh   = make(chan Event)
@@ -72,9 +204,31 @@ func NewSyncedEventStream(stream EventStream) SelectableEventStream {
 			close(inCh)
 			close(subsCh)
 			close(haltCh)
+			close(haltedCh)
 		}
 	}()
 
+	// Every subscription made with Subscribe or SubscribeContext
+	subscriptions := make(map[*syncedSubscription]struct{})
+
+	newSubscription := func(w EventWriter) *syncedSubscription {
+		sub := &syncedSubscription{
+			w:           w,
+			unsubscribe: unsubscribeCh,
+			halted:      haltedCh,
+			done:        make(chan struct{}),
+		}
+
+		if emitter, isCancelable := stream.(CancelableEventEmitter); isCancelable {
+			sub.inner = emitter.SubscribeCancelable(sub)
+		} else {
+			stream.Subscribe(sub)
+		}
+
+		subscriptions[sub] = struct{}{}
+		return sub
+	}
+
 	go func() {
 		var haltReq eventStreamHaltReq
 
@@ -85,13 +239,31 @@ func NewSyncedEventStream(stream EventStream) SelectableEventStream {
 				stream.Write(e)
 
 			case w := <-subs:
-				stream.Subscribe(w)
+				newSubscription(w)
+
+			case req := <-subscribe:
+				req.subscribed <- newSubscription(req.w)
+
+			case sub := <-unsubscribe:
+				if _, exists := subscriptions[sub]; exists {
+					delete(subscriptions, sub)
+					sub.end()
+				}
 
 			case haltReq = <-halt:
 				break communication
 			}
 		}
 
+		for sub := range subscriptions {
+			delete(subscriptions, sub)
+			sub.end()
+
+			if closer, canClose := sub.w.(EventWriteCloser); canClose {
+				closer.Close()
+			}
+		}
+
 		closeChans()
 		haltReq.hasHalted <- stream
 	}()
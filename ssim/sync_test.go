@@ -1,6 +1,7 @@
 package ssim_test
 
 import (
+	"context"
 	"time"
 
 	"github.com/ghthor/filu/ssim"
@@ -53,3 +54,147 @@ func DescribeSyncedStream(c gospec.Context) {
 		})
 	})
 }
+
+// An EventStream that isn't a CancelableEventEmitter
+type uncancelableEventStream struct {
+	subs []ssim.EventWriter
+}
+
+func (s *uncancelableEventStream) Subscribe(w ssim.EventWriter) {
+	s.subs = append(s.subs, w)
+}
+
+func (s *uncancelableEventStream) Write(e ssim.Event) {
+	for _, w := range s.subs {
+		w.Write(e)
+	}
+}
+
+type closableEventWriter struct {
+	mockSyncedEventWriter
+	closed chan struct{}
+}
+
+func (w closableEventWriter) Close() { close(w.closed) }
+
+func DescribeSyncedStreamSubscriptions(c gospec.Context) {
+	c.Specify("a synced stream subscription", func() {
+		now := time.Now()
+		log := ssim.NewMemEventLog(ssim.NowProvider(func() time.Time {
+			return now
+		}))
+
+		syncedLog := ssim.NewSyncedEventStream(log)
+
+		out := mockSyncedEventWriter{make(chan ssim.Event, 2)}
+
+		c.Specify("can be canceled", func() {
+			sub := syncedLog.SubscribeContext(context.Background(), out)
+
+			syncedLog.Write() <- mockEvent{}
+			c.Expect(<-out.lastWrite, Equals, mockEvent{recv: now})
+
+			sub.Cancel()
+			<-sub.Done()
+
+			syncedLog.Write() <- mockEvent{}
+			c.Expect(syncedLog.HaltStream(), Equals, log)
+			c.Expect(len(out.lastWrite), Equals, 0)
+		})
+
+		c.Specify("will be canceled when its context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			sub := syncedLog.SubscribeContext(ctx, out)
+
+			cancel()
+			<-sub.Done()
+
+			syncedLog.Write() <- mockEvent{}
+			c.Expect(syncedLog.HaltStream(), Equals, log)
+			c.Expect(len(out.lastWrite), Equals, 0)
+		})
+
+		c.Specify("will end when the stream halts", func() {
+			sub := syncedLog.SubscribeContext(context.Background(), out)
+
+			closable := closableEventWriter{
+				mockSyncedEventWriter{make(chan ssim.Event, 1)},
+				make(chan struct{}),
+			}
+			closableSub := syncedLog.SubscribeContext(context.Background(), closable)
+
+			other := closableEventWriter{
+				mockSyncedEventWriter{make(chan ssim.Event, 1)},
+				make(chan struct{}),
+			}
+			syncedLog.Subscribe() <- other
+
+			c.Expect(syncedLog.HaltStream(), Equals, log)
+
+			_, isOpen := <-sub.Done()
+			c.Expect(isOpen, IsFalse)
+
+			_, isOpen = <-closableSub.Done()
+			c.Expect(isOpen, IsFalse)
+
+			_, isOpen = <-closable.closed
+			c.Expect(isOpen, IsFalse)
+
+			c.Specify("and its subscribers will be removed from the stream", func() {
+				log.Write(mockEvent{})
+				c.Expect(len(out.lastWrite), Equals, 0)
+				c.Expect(len(closable.lastWrite), Equals, 0)
+			})
+
+			c.Specify("and subscribers added with Subscribe will be removed and closed", func() {
+				_, isOpen := <-other.closed
+				c.Expect(isOpen, IsFalse)
+
+				log.Write(mockEvent{})
+				c.Expect(len(other.lastWrite), Equals, 0)
+			})
+
+			c.Specify("and will not block a late cancel or subscribe", func() {
+				sub.Cancel()
+
+				sub = syncedLog.SubscribeContext(context.Background(), out)
+				_, isOpen := <-sub.Done()
+				c.Expect(isOpen, IsFalse)
+			})
+		})
+
+		c.Specify("will not end the subscribers of the stream it synchronizes", func() {
+			log := ssim.NewMemEventLog(ssim.NowProvider(func() time.Time {
+				return now
+			}))
+
+			direct := mockSyncedEventWriter{make(chan ssim.Event, 1)}
+			log.Subscribe(direct)
+
+			syncedLog := ssim.NewSyncedEventStream(log)
+			c.Expect(syncedLog.HaltStream(), Equals, log)
+
+			log.Write(mockEvent{})
+			c.Expect(<-direct.lastWrite, Equals, mockEvent{recv: now})
+		})
+
+		c.Specify("of a stream that isn't cancelable", func() {
+			stream := &uncancelableEventStream{}
+			syncedStream := ssim.NewSyncedEventStream(stream)
+
+			c.Specify("will stop writing to its subscriber when canceled", func() {
+				sub := syncedStream.SubscribeContext(context.Background(), out)
+
+				syncedStream.Write() <- mockEvent{}
+				c.Expect(<-out.lastWrite, Equals, mockEvent{})
+
+				sub.Cancel()
+				<-sub.Done()
+
+				syncedStream.Write() <- mockEvent{}
+				c.Expect(syncedStream.HaltStream(), Equals, ssim.EventStream(stream))
+				c.Expect(len(out.lastWrite), Equals, 0)
+			})
+		})
+	})
+}